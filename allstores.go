@@ -0,0 +1,58 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StoreNames returns the names of the Rocket.Chat file stores the migrator knows about
+func StoreNames() []string {
+	names := make([]string, 0, len(fileStores))
+	for _, fileStore := range fileStores {
+		names = append(names, fileStore.Name)
+	}
+
+	return names
+}
+
+// MigrateAllStores runs MigrateStore for every known store in sequence, sharing the same
+// database connection, and logs a combined summary once done. The reports of the stores
+// migrated so far are returned along with the error when a store fails
+func (m *Migrate) MigrateAllStores(ctx context.Context) ([]*Report, error) {
+	start := time.Now()
+
+	var reports []*Report
+
+	for _, storeName := range StoreNames() {
+		if err := m.SetStoreName(storeName); err != nil {
+			return reports, err
+		}
+
+		m.infoLog("Migrating store:", storeName)
+
+		report, err := m.MigrateStore(ctx)
+		if report != nil {
+			reports = append(reports, report)
+		}
+
+		if err != nil {
+			return reports, fmt.Errorf("migrating %s: %w", storeName, err)
+		}
+	}
+
+	var files, migrated, skipped, failed int
+
+	for _, report := range reports {
+		m.infoLog(report.Summary())
+
+		files += report.TotalFiles
+		migrated += report.Migrated
+		skipped += report.SkippedIncomplete + report.SkippedNotFound + report.SkippedDone
+		failed += len(report.Failed)
+	}
+
+	m.infoLog(fmt.Sprintf("All stores: %d files, %d migrated, %d skipped, %d failed in %s", files, migrated, skipped, failed, time.Since(start).Round(time.Second)))
+
+	return reports, nil
+}
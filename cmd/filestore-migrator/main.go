@@ -1,39 +1,176 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	pkg "github.com/RocketChat/filestore-migrator"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Exit codes of the tool, one per class of error
+const (
+	exitFailure                = 1
+	exitInvalidConfig          = 2
+	exitDatabaseUnreachable    = 3
+	exitSourceUnreachable      = 4
+	exitDestinationUnreachable = 5
+	exitInterrupted            = 130
+)
+
+// errVerifyFailed is returned when the verify action found mismatches
+var errVerifyFailed = errors.New("verification found mismatches")
+
 func main() {
+	if err := run(); err != nil {
+		log.Println(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the exit code matching the class of the error
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, pkg.ErrInvalidConfig):
+		return exitInvalidConfig
+	case errors.Is(err, pkg.ErrDatabaseUnreachable):
+		return exitDatabaseUnreachable
+	case errors.Is(err, pkg.ErrSourceUnreachable):
+		return exitSourceUnreachable
+	case errors.Is(err, pkg.ErrDestinationUnreachable):
+		return exitDestinationUnreachable
+	default:
+		return exitFailure
+	}
+}
+
+// signalContext returns a context cancelled on the first SIGINT or SIGTERM. The files in progress
+// are then aborted, their partial copies removed and the journal flushed before exiting. A second
+// signal gets the default behaviour, killing the process straight away
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("Received %s, stopping once the files in progress are aborted. Send it again to exit immediately", sig)
+		case <-ctx.Done():
+		}
+
+		signal.Stop(signals)
+		cancel()
+	}()
+
+	return ctx, cancel
+}
+
+func run() error {
 	configFile := flag.String("config", "", "Config File full path. Defaults to current folder")
 	databaseURL := flag.String("databaseUrl", "", "Rocket.Chat database connection string")
 	detectSource := flag.Bool("detectSource", true, "Autodetect the source target using the Rocket.Chat configuration")
 	detectDestination := flag.Bool("detectDestination", false, "Autodetect the destionation using the Rocket.Chat configuration")
-	sourceType := flag.String("sourceType", "s3", "Source storage provider (s3, google, gridfs, filesystem)")
+	sourceType := flag.String("sourceType", "s3", "Source storage provider (s3, google, azure, webdav, sftp, gridfs, filesystem)")
 	sourceURL := flag.String("sourceUrl", "", "Source connection string")
-	destinationType := flag.String("destinationType", "s3", "Destination storage provider (s3, google, fs)")
+	destinationType := flag.String("destinationType", "s3", "Destination storage provider (s3, google, azure, webdav, sftp, gridfs, fs)")
 	destinationURL := flag.String("destinationUrl", "", "Destination connection string")
 	tempLocation := flag.String("tempLocation", "/tmp/filestore-migrator", "Temporary file location")
-	store := flag.String("store", "Uploads", "Name of the storage to be used in the operation")
-	action := flag.String("action", "download", "Type of action to me performed by the tool (migrate, upload, download )")
+	store := flag.String("store", "Uploads", "Name of the storage to be used in the operation (Uploads, Avatars, UserDataFiles or all)")
+	action := flag.String("action", "download", "Type of action to me performed by the tool (migrate, upload, download, retry-failed, verify, rollback, delete-source, orphans)")
+	failedList := flag.String("failedList", "", "List of failed files to be migrated again by the retry-failed action. Defaults to failed.jsonl in the temp file location")
 	skipErrors := flag.Bool("skipErrors", false, "Skip on error")
 	verbose := flag.Bool("verbose", true, "Enable verbose logs")
+	logFormat := flag.String("logFormat", "", "Format of the logs (text, json). Defaults to the config value or text")
+	showProgress := flag.Bool("progress", true, "Show the progress of the migrate, download and upload runs on stdout, as a bar on a terminal and as a line every 30s otherwise")
+	dryRun := flag.Bool("dryRun", false, "Print the plan of the migrate, download or upload action without transferring or updating anything")
+	planFile := flag.String("planFile", "", "Write the dry run plan as JSON to this file instead of stdout")
+	reportFile := flag.String("reportFile", "", "Write the report of the migrate, upload or download run to this file, as CSV when it ends in .csv and JSON otherwise")
+	orphansReport := flag.String("orphansReport", "", "Write the orphans report as JSON to this file instead of stdout")
+	deleteOrphans := flag.Bool("deleteOrphans", false, "Remove the objects found by the orphans action that no document references")
+	verifyReport := flag.String("verifyReport", "", "Write the verify report as JSON to this file instead of stdout")
+	deleteSource := flag.Bool("deleteSource", false, "Remove the source copy of the files once migrated and verified on the destination")
+	deleteSourceAfter := flag.Duration("deleteSourceAfter", 0, "Only remove the source copy of files migrated longer ago than this (e.g. 720h, defaults to the config value or 0)")
+	runID := flag.String("runId", "", "Id of the run to be restored by the rollback action")
+	resume := flag.Bool("resume", false, "Resume from the journal left by the last migrate or upload run")
+	retryAttempts := flag.Int("retryAttempts", 0, "Number of attempts for operations failing with transient errors (defaults to the config value or 5)")
+	retryBackoff := flag.Duration("retryBackoff", 0, "Wait before the first retry, doubled on every following one (defaults to the config value or 1s)")
+	retryMaxBackoff := flag.Duration("retryMaxBackoff", 0, "Maximum wait between two attempts (defaults to the config value or 30s)")
+	retryJitter := flag.Float64("retryJitter", -1, "Fraction between 0 and 1 by which the waits between attempts are randomized (defaults to the config value or 0.2)")
+	concurrency := flag.Int("concurrency", 0, "Number of files to be processed in parallel (defaults to the config value or 1)")
+	metricsAddr := flag.String("metricsAddr", "", "Serve Prometheus metrics on /metrics at this address (e.g. :9100)")
+	batchSize := flag.Int("batchSize", 0, "Number of file documents fetched from the database at a time (defaults to the config value or 1000)")
+	rids := flag.String("rids", "", "Comma separated ids of the rooms whose files are processed")
+	userIDs := flag.String("userIds", "", "Comma separated ids of the users whose files are processed")
+	uploadedAfter := flag.String("uploadedAfter", "", "Only process files uploaded at or after this date (2006-01-02 or RFC 3339)")
+	uploadedBefore := flag.String("uploadedBefore", "", "Only process files uploaded before this date (2006-01-02 or RFC 3339)")
+	minSize := flag.Int64("minSize", 0, "Only process files of at least this many bytes")
+	maxSize := flag.Int64("maxSize", 0, "Only process files of at most this many bytes")
+	types := flag.String("types", "", "Comma separated MIME type globs of the files processed (e.g. image/*)")
+	idsFile := flag.String("idsFile", "", "File listing, one per line, the ids of the files processed")
 
 	flag.Parse()
 
+	if err := checkDryRun(*action, *dryRun); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var progress *progressDisplay
+
+	if *showProgress && !*dryRun && (*action == "migrate" || *action == "download" || *action == "upload" || *action == "retry-failed") {
+		progress = startProgress(os.Stderr)
+		defer progress.stop()
+	}
+
+	// on a terminal the logs go through the progress display so they don't run into the bar
+	var logOutput io.Writer = os.Stderr
+	if progress != nil && progress.tty {
+		logOutput = progress
+
+		log.SetOutput(logOutput)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	switch *logFormat {
+	case pkg.LogFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logOutput, nil)))
+	case "", pkg.LogFormatText:
+	default:
+		return fmt.Errorf("%w: invalid logFormat %q, must be text or json", pkg.ErrInvalidConfig, *logFormat)
+	}
+
 	// We don't need the source config details. They will have to tell us
 	if *action == "upload" {
 		*detectSource = false
 	}
 
 	if *action == "upload" && *sourceType == "" {
-		panic("When specifying upload action you need to provide at least the sourceType")
+		return fmt.Errorf("%w: When specifying upload action you need to provide at least the sourceType", pkg.ErrInvalidConfig)
 	}
 
-	config, err := Parse(*configFile,
+	config, err := Parse(ctx,
+		*configFile,
 		*databaseURL,
 		*detectSource,
 		*detectDestination,
@@ -45,38 +182,399 @@ func main() {
 		*verbose,
 		*action)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	migrate, err := pkg.New(config, *skipErrors)
+	migrate, err := pkg.New(ctx, config, *skipErrors)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if *logFormat != "" {
+		if err := migrate.SetLogFormat(*logFormat); err != nil {
+			return err
+		}
+	}
+
+	if progress != nil {
+		if progress.tty {
+			if err := migrate.SetLogOutput(logOutput); err != nil {
+				return err
+			}
+		}
+
+		migrate.SetProgressHook(progress.track)
+	}
+
+	migrate.SetResume(*resume)
+
+	applyDeleteSource(migrate, flag.CommandLine, *deleteSource, *deleteSourceAfter)
+
+	retryPolicy := migrate.RetryPolicy()
+
+	if *retryAttempts > 0 {
+		retryPolicy.MaxAttempts = *retryAttempts
+	}
+
+	if *retryBackoff > 0 {
+		retryPolicy.BaseBackoff = *retryBackoff
+	}
+
+	if *retryMaxBackoff > 0 {
+		retryPolicy.MaxBackoff = *retryMaxBackoff
+	}
+
+	if *retryJitter >= 0 {
+		retryPolicy.Jitter = *retryJitter
+	}
+
+	if err := migrate.SetRetryPolicy(retryPolicy); err != nil {
+		return err
+	}
+
+	if *concurrency > 0 {
+		if err := migrate.SetConcurrency(*concurrency); err != nil {
+			return err
+		}
+	}
+
+	if *metricsAddr != "" {
+		metrics, err := pkg.NewMetrics(prometheus.DefaultRegisterer)
+		if err != nil {
+			return err
+		}
+
+		migrate.SetMetrics(metrics)
+
+		server, err := serveMetrics(*metricsAddr)
+		if err != nil {
+			return err
+		}
+
+		defer server.Close()
+	}
+
+	if *batchSize > 0 {
+		if err := migrate.SetBatchSize(*batchSize); err != nil {
+			return err
+		}
+	}
+
+	filter := migrate.Filter()
+
+	if *rids != "" {
+		filter.Rids = splitList(*rids)
+	}
+
+	if *userIDs != "" {
+		filter.UserIDs = splitList(*userIDs)
+	}
+
+	if *uploadedAfter != "" {
+		after, err := pkg.ParseFilterTime(*uploadedAfter)
+		if err != nil {
+			return fmt.Errorf("%w: invalid uploadedAfter value: %w", pkg.ErrInvalidConfig, err)
+		}
+
+		filter.UploadedAfter = after
+	}
+
+	if *uploadedBefore != "" {
+		before, err := pkg.ParseFilterTime(*uploadedBefore)
+		if err != nil {
+			return fmt.Errorf("%w: invalid uploadedBefore value: %w", pkg.ErrInvalidConfig, err)
+		}
+
+		filter.UploadedBefore = before
+	}
+
+	if *minSize > 0 {
+		filter.MinSize = *minSize
+	}
+
+	if *maxSize > 0 {
+		filter.MaxSize = *maxSize
+	}
+
+	if *types != "" {
+		filter.Types = splitList(*types)
+	}
+
+	if *idsFile != "" {
+		ids, err := pkg.ReadIDsFile(*idsFile)
+		if err != nil {
+			return err
+		}
+
+		filter.IDs = ids
+	}
+
+	if err := migrate.SetFilter(filter); err != nil {
+		return err
 	}
 
-	if err := migrate.SetStoreName(*store); err != nil {
-		panic(err)
+	stores := []string{*store}
+	if *store == "all" {
+		stores = pkg.StoreNames()
 	}
 
-	switch *action {
-	case "migrate":
-		log.Println("Beginning migration of files")
-		if err := migrate.MigrateStore(); err != nil {
-			panic(err)
+	if *action == "migrate" && !*dryRun && len(stores) > 1 {
+		log.Println("Beginning migration of all stores, run id:", migrate.RunID())
+		reports, err := migrate.MigrateAllStores(ctx)
+		for _, report := range reports {
+			writeReport(report, reportPath(*reportFile, report.Store, true), migrate.FailedListPath())
+		}
+
+		if err != nil {
+			return err
 		}
-	case "upload":
-		log.Println("Beginning upload of files")
-		if err := migrate.UploadAll(config.TempFileLocation); err != nil {
-			panic(err)
+
+		log.Println("Finished!")
+
+		return nil
+	}
+
+	verifyFailed := false
+
+	for _, storeName := range stores {
+		if err := migrate.SetStoreName(storeName); err != nil {
+			return err
+		}
+
+		if *dryRun {
+			filesRoot := ""
+			if *action == "upload" {
+				filesRoot = config.TempFileLocation
+			}
+
+			plan, err := migrate.Plan(ctx, filesRoot)
+			if err != nil {
+				return err
+			}
+
+			log.Println(plan.Summary())
+			if err := outputReport(plan, reportPath(*planFile, storeName, len(stores) > 1), "Plan"); err != nil {
+				return err
+			}
+
+			continue
 		}
-	case "download":
-		log.Println("Beginning download of files")
-		if err := migrate.DownloadAll(); err != nil {
-			panic(err)
+
+		switch *action {
+		case "migrate":
+			log.Println("Beginning migration of files, run id:", migrate.RunID())
+			report, err := migrate.MigrateStore(ctx)
+			writeReport(report, reportPath(*reportFile, storeName, len(stores) > 1), migrate.FailedListPath())
+
+			if err != nil {
+				return err
+			}
+		case "upload":
+			log.Println("Beginning upload of files, run id:", migrate.RunID())
+			report, err := migrate.UploadAll(ctx, config.TempFileLocation)
+			writeReport(report, reportPath(*reportFile, storeName, len(stores) > 1), migrate.FailedListPath())
+
+			if err != nil {
+				return err
+			}
+		case "download":
+			log.Println("Beginning download of files")
+			report, err := migrate.DownloadAll(ctx)
+			writeReport(report, reportPath(*reportFile, storeName, len(stores) > 1), migrate.FailedListPath())
+
+			if err != nil {
+				return err
+			}
+		case "retry-failed":
+			log.Println("Beginning retry of failed files, run id:", migrate.RunID())
+			report, err := migrate.RetryFailed(ctx, *failedList)
+			writeReport(report, reportPath(*reportFile, storeName, len(stores) > 1), migrate.FailedListPath())
+
+			if err != nil {
+				return err
+			}
+		case "verify":
+			log.Println("Beginning verification of files")
+			report, err := migrate.Verify(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Println(report.Summary())
+			if err := outputReport(report, reportPath(*verifyReport, storeName, len(stores) > 1), "Verify report"); err != nil {
+				return err
+			}
+
+			if len(report.Mismatches) > 0 {
+				verifyFailed = true
+			}
+		case "rollback":
+			log.Println("Beginning rollback of run:", *runID)
+			if err := migrate.Rollback(ctx, *runID); err != nil {
+				return err
+			}
+		case "delete-source":
+			log.Println("Beginning deletion of migrated files from source")
+			if err := migrate.DeleteSources(ctx, migrate.DeleteSourceAfter()); err != nil {
+				return err
+			}
+		case "orphans":
+			log.Println("Beginning search for orphan files")
+			report, err := migrate.Orphans(ctx, *deleteOrphans)
+			if err != nil {
+				return err
+			}
+
+			log.Println(report.Summary())
+			if err := outputReport(report, reportPath(*orphansReport, storeName, len(stores) > 1), "Orphans report"); err != nil {
+				return err
+			}
+		default:
+			flag.Usage()
+			return fmt.Errorf("%w: unknown action %q", pkg.ErrInvalidConfig, *action)
 		}
+	}
+
+	if verifyFailed {
+		return errVerifyFailed
+	}
+
+	log.Println("Finished!")
+
+	return nil
+}
+
+// checkDryRun refuses a dry run of the actions the plan doesn't describe, which would otherwise
+// print the plan of a migration instead of what the action does
+func checkDryRun(action string, dryRun bool) error {
+	if !dryRun {
+		return nil
+	}
+
+	switch action {
+	case "migrate", "download", "upload":
+		return nil
 	default:
-		flag.Usage()
+		return fmt.Errorf("%w: -dryRun is only supported by the migrate, download and upload actions, not %q", pkg.ErrInvalidConfig, action)
+	}
+}
+
+// reportPath returns the path a report of the store is written to. When several stores are
+// processed in the same run the store name is added to the file name so they don't overwrite each other
+func reportPath(path string, storeName string, multipleStores bool) string {
+	if path == "" || !multipleStores {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "-" + strings.ToLower(storeName) + ext
+}
+
+// writeReport logs the summary of the run report and writes it to path when one is given.
+// The report is written even when the run failed so the files processed so far are accounted for
+func writeReport(report *pkg.Report, path string, failedList string) {
+	if report == nil {
 		return
 	}
 
-	log.Println("Finished!")
+	log.Println(report.Summary())
+
+	if len(report.Failed) > 0 {
+		log.Printf("Failed files listed in %s, they can be migrated again with -action retry-failed", failedList)
+	}
+
+	if path == "" {
+		return
+	}
+
+	if err := report.Write(path); err != nil {
+		log.Println("Failed to write report:", err)
+		return
+	}
+
+	log.Printf("Report written to: %s", path)
+}
+
+// outputReport writes the report as JSON to path, or prints it to stdout when no path is given
+func outputReport(report interface{ WriteJSON(path string) error }, path string, name string) error {
+	if path != "" {
+		if err := report.WriteJSON(path); err != nil {
+			return err
+		}
+
+		log.Printf("%s written to: %s", name, path)
+
+		return nil
+	}
+
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+
+	return nil
+}
+
+// serveMetrics serves the Prometheus metrics on /metrics at addr until the server is closed
+func serveMetrics(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to serve metrics: %w", pkg.ErrInvalidConfig, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("Metrics server stopped:", err)
+		}
+	}()
+
+	log.Printf("Serving metrics on %s/metrics", listener.Addr())
+
+	return server, nil
+}
+
+// splitList returns the non empty values of a comma separated list
+func splitList(list string) []string {
+	var values []string
+
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// applyDeleteSource sets the delete source options of the command line. The grace period of the
+// config is only overridden when -deleteSourceAfter is given
+func applyDeleteSource(migrate *pkg.Migrate, flags *flag.FlagSet, deleteSource bool, deleteSourceAfter time.Duration) {
+	if flagPassed(flags, "deleteSourceAfter") {
+		migrate.SetDeleteSourceAfter(deleteSourceAfter)
+	}
+
+	if deleteSource {
+		migrate.SetDeleteSource(true)
+	}
+}
+
+// flagPassed reports whether the flag name was given on the command line
+func flagPassed(flags *flag.FlagSet, name string) bool {
+	passed := false
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+
+	return passed
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	pkg "github.com/RocketChat/filestore-migrator"
+)
+
+func TestCheckDryRun(t *testing.T) {
+	tests := []struct {
+		action  string
+		dryRun  bool
+		wantErr bool
+	}{
+		{action: "migrate", dryRun: true},
+		{action: "download", dryRun: true},
+		{action: "upload", dryRun: true},
+		{action: "rollback", dryRun: true, wantErr: true},
+		{action: "delete-source", dryRun: true, wantErr: true},
+		{action: "orphans", dryRun: true, wantErr: true},
+		{action: "verify", dryRun: true, wantErr: true},
+		{action: "retry-failed", dryRun: true, wantErr: true},
+		{action: "rollback"},
+		{action: "orphans"},
+	}
+
+	for _, tt := range tests {
+		err := checkDryRun(tt.action, tt.dryRun)
+
+		if tt.wantErr != (err != nil) {
+			t.Errorf("checkDryRun(%q, %v) = %v, want error %v", tt.action, tt.dryRun, err, tt.wantErr)
+		}
+
+		if err != nil && !errors.Is(err, pkg.ErrInvalidConfig) {
+			t.Errorf("checkDryRun(%q, %v) = %v, want ErrInvalidConfig", tt.action, tt.dryRun, err)
+		}
+	}
+}
+
+func TestFlagPassed(t *testing.T) {
+	tests := []struct {
+		args   []string
+		passed bool
+	}{
+		{args: nil},
+		{args: []string{"-deleteSource"}},
+		{args: []string{"-deleteSourceAfter", "0"}, passed: true},
+		{args: []string{"-deleteSource", "-deleteSourceAfter=720h"}, passed: true},
+	}
+
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.Bool("deleteSource", false, "")
+		flags.Duration("deleteSourceAfter", time.Hour, "")
+
+		if err := flags.Parse(tt.args); err != nil {
+			t.Fatalf("Parse(%v) = %v", tt.args, err)
+		}
+
+		if passed := flagPassed(flags, "deleteSourceAfter"); passed != tt.passed {
+			t.Errorf("flagPassed(%v) = %v, want %v", tt.args, passed, tt.passed)
+		}
+	}
+}
+
+func TestApplyDeleteSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantAfter time.Duration
+	}{
+		{name: "keeps the config value", args: []string{"-deleteSource"}, wantAfter: 720 * time.Hour},
+		{name: "flag overrides the config value", args: []string{"-deleteSource", "-deleteSourceAfter", "24h"}, wantAfter: 24 * time.Hour},
+		{name: "zero flag overrides the config value", args: []string{"-deleteSourceAfter", "0"}, wantAfter: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			deleteSource := flags.Bool("deleteSource", false, "")
+			deleteSourceAfter := flags.Duration("deleteSourceAfter", 0, "")
+
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			// the grace period read from the config
+			migrate := &pkg.Migrate{}
+			migrate.SetDeleteSourceAfter(720 * time.Hour)
+
+			applyDeleteSource(migrate, flags, *deleteSource, *deleteSourceAfter)
+
+			if after := migrate.DeleteSourceAfter(); after != tt.wantAfter {
+				t.Fatalf("DeleteSourceAfter() = %s, want %s", after, tt.wantAfter)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -32,11 +33,6 @@ func parseDatabase(url string) (*config.DatabaseConfig, error) {
 
 func parseTarget(name string, typ string, connstr string, action string) (*config.MigrateTarget, error) {
 	if typ != "" {
-		if name == "destination" && typ == "gridfs" {
-			err := errors.New("You cannot use gridfs as a destination target")
-			return nil, err
-		}
-
 		switch typ {
 		case "gridfs":
 			target := config.MigrateTarget{
@@ -59,7 +55,7 @@ func parseTarget(name string, typ string, connstr string, action string) (*confi
 
 			urlInfo, err := url.Parse(connstr)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("The informed S3 connection string is not a valid URL: %w", err)
 			}
 			endpoint := urlInfo.Host
 			if endpoint == "" {
@@ -92,7 +88,7 @@ func parseTarget(name string, typ string, connstr string, action string) (*confi
 			}
 			ssl, err := strconv.ParseBool(urlInfo.Query().Get("ssl"))
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("The informed S3 connection string ssl field must be true or false: %w", err)
 			}
 			target.AmazonS3 = config.MigrateTargetS3{
 				Endpoint:  endpoint,
@@ -139,6 +135,164 @@ func parseTarget(name string, typ string, connstr string, action string) (*confi
 				Bucket:  bucket,
 			}
 
+			return &target, nil
+		case "azure":
+			target := config.MigrateTarget{
+				Type: "AzureBlob",
+			}
+
+			if name == "source" && action == "upload" {
+				target.ReferenceOnly = true
+				return &target, nil
+			}
+
+			if connstr == "" {
+				return nil, fmt.Errorf("The %s target information is incomplete", name)
+			}
+
+			urlInfo, err := url.Parse(connstr)
+			if err != nil {
+				return nil, fmt.Errorf("The informed Azure connection string is not a valid URL: %w", err)
+			}
+			if urlInfo.Scheme != "azure" {
+				err := errors.New("The informed Azure connection string must start with azure://")
+				return nil, err
+			}
+			account := urlInfo.Host
+			if account == "" {
+				err := errors.New("The informed Azure connection string doesn't contain the account field")
+				return nil, err
+			}
+			container := strings.Trim(urlInfo.EscapedPath(), "/")
+			if container == "" {
+				err := errors.New("The informed Azure connection string doesn't contain the container field")
+				return nil, err
+			}
+			// account keys are base64, so a + left unescaped in the query must not become a space
+			accountKey := strings.ReplaceAll(urlInfo.Query().Get("key"), " ", "+")
+			sasToken := urlInfo.Query().Get("sas")
+			if accountKey == "" && sasToken == "" {
+				err := errors.New("The informed Azure connection string doesn't contain either the key or the sas field")
+				return nil, err
+			}
+
+			target.AzureBlob = config.MigrateTargetAzure{
+				Account:    account,
+				AccountKey: accountKey,
+				SASToken:   sasToken,
+				Container:  container,
+				Endpoint:   urlInfo.Query().Get("endpoint"),
+			}
+
+			return &target, nil
+		case "webdav":
+			target := config.MigrateTarget{
+				Type: "Webdav",
+			}
+
+			if name == "source" && action == "upload" {
+				target.ReferenceOnly = true
+				return &target, nil
+			}
+
+			if connstr == "" {
+				return nil, fmt.Errorf("The %s target information is incomplete", name)
+			}
+
+			urlInfo, err := url.Parse(connstr)
+			if err != nil {
+				return nil, fmt.Errorf("The informed WebDAV connection string is not a valid URL: %w", err)
+			}
+			if urlInfo.Scheme != "http" && urlInfo.Scheme != "https" {
+				err := errors.New("The informed WebDAV connection string must start with http:// or https://")
+				return nil, err
+			}
+			if urlInfo.Host == "" {
+				err := errors.New("The informed WebDAV connection string doesn't contain the host field")
+				return nil, err
+			}
+
+			username := urlInfo.User.Username()
+			password, _ := urlInfo.User.Password()
+			folder := urlInfo.Query().Get("folder")
+
+			// the credentials and the folder are kept apart from the server URL
+			urlInfo.User = nil
+			urlInfo.RawQuery = ""
+
+			target.Webdav = config.MigrateTargetWebdav{
+				ServerURL:        urlInfo.String(),
+				Username:         username,
+				Password:         password,
+				UploadFolderPath: folder,
+			}
+
+			return &target, nil
+		case "sftp":
+			target := config.MigrateTarget{
+				Type: "SFTP",
+			}
+
+			if name == "source" && action == "upload" {
+				target.ReferenceOnly = true
+				return &target, nil
+			}
+
+			if connstr == "" {
+				return nil, fmt.Errorf("The %s target information is incomplete", name)
+			}
+
+			urlInfo, err := url.Parse(connstr)
+			if err != nil {
+				return nil, fmt.Errorf("The informed SFTP connection string is not a valid URL: %w", err)
+			}
+			if urlInfo.Scheme != "sftp" {
+				err := errors.New("The informed SFTP connection string must start with sftp://")
+				return nil, err
+			}
+			if urlInfo.Hostname() == "" {
+				err := errors.New("The informed SFTP connection string doesn't contain the host field")
+				return nil, err
+			}
+			user := urlInfo.User.Username()
+			if user == "" {
+				err := errors.New("The informed SFTP connection string doesn't contain the user field")
+				return nil, err
+			}
+			if urlInfo.Path == "" || urlInfo.Path == "/" {
+				err := errors.New("The informed SFTP connection string doesn't contain the path field")
+				return nil, err
+			}
+			password, _ := urlInfo.User.Password()
+
+			port := 0
+			if urlInfo.Port() != "" {
+				port, err = strconv.Atoi(urlInfo.Port())
+				if err != nil {
+					return nil, fmt.Errorf("The informed SFTP connection string port field is not valid: %w", err)
+				}
+			}
+
+			insecure := false
+			if urlInfo.Query().Get("insecure") != "" {
+				insecure, err = strconv.ParseBool(urlInfo.Query().Get("insecure"))
+				if err != nil {
+					return nil, fmt.Errorf("The informed SFTP connection string insecure field is not valid: %w", err)
+				}
+			}
+
+			target.SFTP = config.MigrateTargetSFTP{
+				Host:                  urlInfo.Hostname(),
+				Port:                  port,
+				User:                  user,
+				Password:              password,
+				KeyFile:               urlInfo.Query().Get("key"),
+				KeyPassphrase:         urlInfo.Query().Get("passphrase"),
+				KnownHostsFile:        urlInfo.Query().Get("knownHosts"),
+				InsecureIgnoreHostKey: insecure,
+				Location:              urlInfo.Path,
+			}
+
 			return &target, nil
 		case "filesystem":
 			fallthrough
@@ -165,7 +319,8 @@ func parseTarget(name string, typ string, connstr string, action string) (*confi
 }
 
 // Parse transforms the command arguments into a configuration file.
-func Parse(configFile string,
+func Parse(ctx context.Context,
+	configFile string,
 	databaseURL string,
 	detectSource bool,
 	detectDestination bool,
@@ -183,27 +338,27 @@ func Parse(configFile string,
 
 		database, err := parseDatabase(databaseURL)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("%w: %w", pkg.ErrInvalidConfig, err)
 		}
 		configuration.Database = *database
 
 		if detectSource && detectDestination {
-			err := errors.New("Cannot auto detect both source and destination targets. Please, pick one")
+			err := fmt.Errorf("%w: Cannot auto detect both source and destination targets. Please, pick one", pkg.ErrInvalidConfig)
 			return nil, err
 		}
 
 		if !detectSource {
 			target, err := parseTarget("source", sourceType, sourceURL, action)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("%w: %w", pkg.ErrInvalidConfig, err)
 			}
 
 			configuration.Source = *target
 		} else {
 			log.Println("Connecting to database to detect source upload config")
-			target, err := pkg.GetRocketChatStore(configuration.Database)
+			target, err := pkg.GetRocketChatStore(ctx, configuration.Database)
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
 			configuration.Source = *target
 		}
@@ -213,15 +368,15 @@ func Parse(configFile string,
 		if !detectDestination {
 			target, err := parseTarget("destination", destinationType, destinationURL, action)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("%w: %w", pkg.ErrInvalidConfig, err)
 			}
 			configuration.Destination = *target
 		} else {
 			log.Println("Connecting to database to detect destination upload config")
 
-			target, err := pkg.GetRocketChatStore(configuration.Database)
+			target, err := pkg.GetRocketChatStore(ctx, configuration.Database)
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
 			configuration.Destination = *target
 		}
@@ -233,7 +388,7 @@ func Parse(configFile string,
 
 	configuration, err := config.Load(configFile)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if verbose {
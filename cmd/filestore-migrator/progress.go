@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pkg "github.com/RocketChat/filestore-migrator"
+	"golang.org/x/term"
+)
+
+const (
+	// progressDrawInterval is how often the progress bar is redrawn on a terminal
+	progressDrawInterval = 250 * time.Millisecond
+	// progressLineInterval is how often a progress line is printed when stdout isn't a terminal
+	progressLineInterval = 30 * time.Second
+	// progressBarWidth is the number of characters of the bar itself
+	progressBarWidth = 30
+)
+
+// progressDisplay shows the progress of the runs on stdout, as a bar redrawn in place on a
+// terminal and as periodic lines otherwise. On a terminal the logs have to be written through
+// it so the bar is cleared before and redrawn after every line
+type progressDisplay struct {
+	out  *os.File
+	logs io.Writer
+	tty  bool
+
+	mu     sync.Mutex
+	report *pkg.Report
+	line   string
+	// rate is the throughput in bytes per second, smoothed over the last updates
+	rate      float64
+	lastBytes int64
+	lastTime  time.Time
+
+	stopOnce sync.Once
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// startProgress starts showing the progress of the runs handed to track on stdout
+func startProgress(logs io.Writer) *progressDisplay {
+	p := &progressDisplay{
+		out:     os.Stdout,
+		logs:    logs,
+		tty:     term.IsTerminal(int(os.Stdout.Fd())),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+// track follows the progress of the report of a run that is starting
+func (p *progressDisplay) track(report *pkg.Report) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+
+	p.report = report
+	p.rate = 0
+	p.lastBytes = 0
+	p.lastTime = time.Now()
+}
+
+// stop stops the display, clearing the bar
+func (p *progressDisplay) stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		<-p.stopped
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.clear()
+		p.report = nil
+	})
+}
+
+// Write writes a log line, clearing the bar before and redrawing it after on a terminal
+func (p *progressDisplay) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	line := p.line
+	p.clear()
+
+	n, err := p.logs.Write(b)
+
+	// the bar of a finished run isn't drawn again, the logs that follow it describe the outcome
+	if line != "" && p.report != nil && !p.report.Progress().Finished {
+		p.draw(line)
+	}
+
+	return n, err
+}
+
+func (p *progressDisplay) run() {
+	defer close(p.stopped)
+
+	interval := progressLineInterval
+	if p.tty {
+		interval = progressDrawInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.update()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// update refreshes the progress of the report being tracked
+func (p *progressDisplay) update() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.report == nil {
+		return
+	}
+
+	progress := p.report.Progress()
+	if progress.Finished {
+		p.clear()
+		p.report = nil
+
+		return
+	}
+
+	now := time.Now()
+	if elapsed := now.Sub(p.lastTime).Seconds(); elapsed > 0 {
+		current := float64(progress.Bytes-p.lastBytes) / elapsed
+
+		// the bytes of a file are only counted once it is done, so the rate is smoothed
+		if p.rate == 0 {
+			p.rate = current
+		} else {
+			p.rate = 0.8*p.rate + 0.2*current
+		}
+	}
+
+	p.lastBytes = progress.Bytes
+	p.lastTime = now
+
+	if p.tty {
+		p.draw(formatProgress(progress, p.rate, true))
+		return
+	}
+
+	fmt.Fprintln(p.out, formatProgress(progress, p.rate, false))
+}
+
+// draw replaces the bar on the terminal with line
+func (p *progressDisplay) draw(line string) {
+	if !p.tty {
+		return
+	}
+
+	if width, _, err := term.GetSize(int(p.out.Fd())); err == nil && width > 1 && len(line) >= width {
+		line = line[:width-1]
+	}
+
+	fmt.Fprint(p.out, "\r\033[K"+line)
+	p.line = line
+}
+
+// clear removes the bar from the terminal
+func (p *progressDisplay) clear() {
+	if !p.tty || p.line == "" {
+		return
+	}
+
+	fmt.Fprint(p.out, "\r\033[K")
+	p.line = ""
+}
+
+// formatProgress describes the progress in a single line, starting with a bar when bar is set
+func formatProgress(progress pkg.Progress, rate float64, bar bool) string {
+	var b strings.Builder
+
+	ratio := 0.0
+	if progress.TotalFiles > 0 {
+		ratio = min(float64(progress.DoneFiles)/float64(progress.TotalFiles), 1)
+	}
+
+	if bar {
+		filled := int(ratio * progressBarWidth)
+		b.WriteString("[" + strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled) + "] ")
+	}
+
+	fmt.Fprintf(&b, "%s %s: %3.0f%% %d/%d files, %s/%s, %s/s",
+		progress.Action, progress.Store, ratio*100, progress.DoneFiles, progress.TotalFiles,
+		formatBytes(float64(progress.Bytes)), formatBytes(float64(progress.TotalBytes)), formatBytes(rate))
+
+	// the ETA follows the pace of the files done so far, whatever their outcome
+	if progress.DoneFiles > 0 && progress.DoneFiles < progress.TotalFiles {
+		perFile := progress.Elapsed / time.Duration(progress.DoneFiles)
+		eta := perFile * time.Duration(progress.TotalFiles-progress.DoneFiles)
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+
+	fmt.Fprintf(&b, ", %d errors", progress.Failed)
+
+	return b.String()
+}
+
+// formatBytes returns the bytes in decimal units, such as 12.3 MB
+func formatBytes(bytes float64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+
+	unit := 0
+	for bytes >= 1000 && unit < len(units)-1 {
+		bytes /= 1000
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", bytes, units[unit])
+	}
+
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pkg "github.com/RocketChat/filestore-migrator"
+)
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress pkg.Progress
+		rate     float64
+		bar      bool
+		want     string
+	}{
+		{
+			name: "half done with bar",
+			progress: pkg.Progress{
+				Action: "migrate", Store: "Uploads", TotalFiles: 10, DoneFiles: 5, Failed: 1,
+				TotalBytes: 3000000, Bytes: 1500000, Elapsed: 10 * time.Second,
+			},
+			rate: 250000,
+			bar:  true,
+			want: "[" + strings.Repeat("=", 15) + strings.Repeat(" ", 15) + "] migrate Uploads:  50% 5/10 files, 1.5 MB/3.0 MB, 250.0 kB/s, ETA 10s, 1 errors",
+		},
+		{
+			name:     "nothing to do",
+			progress: pkg.Progress{Action: "download", Store: "Avatars"},
+			want:     "download Avatars:   0% 0/0 files, 0 B/0 B, 0 B/s, 0 errors",
+		},
+		{
+			name: "finished",
+			progress: pkg.Progress{
+				Action: "upload", Store: "Uploads", TotalFiles: 4, DoneFiles: 4,
+				TotalBytes: 2500000000, Bytes: 2500000000, Elapsed: time.Minute, Finished: true,
+			},
+			bar:  true,
+			want: "[" + strings.Repeat("=", 30) + "] upload Uploads: 100% 4/4 files, 2.5 GB/2.5 GB, 0 B/s, 0 errors",
+		},
+		{
+			name: "more files done than counted",
+			progress: pkg.Progress{
+				Action: "migrate", Store: "UserDataFiles", TotalFiles: 2, DoneFiles: 3,
+				TotalBytes: 999, Bytes: 1200, Elapsed: time.Second,
+			},
+			rate: 999,
+			want: "migrate UserDataFiles: 100% 3/2 files, 1.2 kB/999 B, 999 B/s, 0 errors",
+		},
+		{
+			name: "eta from the pace of the files",
+			progress: pkg.Progress{
+				Action: "migrate", Store: "Uploads", TotalFiles: 100, DoneFiles: 25,
+				TotalBytes: 100, Bytes: 25, Elapsed: 90 * time.Second,
+			},
+			rate: 0.5,
+			want: "migrate Uploads:  25% 25/100 files, 25 B/100 B, 0 B/s, ETA 4m30s, 0 errors",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatProgress(tt.progress, tt.rate, tt.bar); got != tt.want {
+				t.Fatalf("formatProgress =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"os"
 
 	yaml "gopkg.in/yaml.v2"
@@ -9,14 +10,44 @@ import (
 
 var _config *Config
 
+// ErrInvalidConfig is returned, wrapped with the details, when the configuration can't be read or is invalid
+var ErrInvalidConfig = errors.New("invalid configuration")
+
 // Config is the configuration object that will be deserialized from yaml and passed into the migrate client
 type Config struct {
-	Database         DatabaseConfig `yaml:"database"`
-	Source           MigrateTarget  `yaml:"source"`
-	Destination      MigrateTarget  `yaml:"destination"`
-	TempFileLocation string         `yaml:"tempFileLocation"`
-	DebugMode        bool           `yaml:"debugMode"`
-	FileDelay        string         `yaml:"fileDelay"`
+	Database          DatabaseConfig `yaml:"database"`
+	Source            MigrateTarget  `yaml:"source"`
+	Destination       MigrateTarget  `yaml:"destination"`
+	TempFileLocation  string         `yaml:"tempFileLocation"`
+	DebugMode         bool           `yaml:"debugMode"`
+	LogFormat         string         `yaml:"logFormat"`
+	FileDelay         string         `yaml:"fileDelay"`
+	Concurrency       int            `yaml:"concurrency"`
+	BatchSize         int            `yaml:"batchSize"`
+	DeleteSource      bool           `yaml:"deleteSource"`
+	DeleteSourceAfter string         `yaml:"deleteSourceAfter"`
+	Retry             RetryConfig    `yaml:"retry"`
+	Filter            FilterConfig   `yaml:"filter"`
+}
+
+// FilterConfig restricts the files processed to those matching every field set
+type FilterConfig struct {
+	Rids           []string `yaml:"rids"`
+	UserIDs        []string `yaml:"userIds"`
+	UploadedAfter  string   `yaml:"uploadedAfter"`
+	UploadedBefore string   `yaml:"uploadedBefore"`
+	MinSize        int64    `yaml:"minSize"`
+	MaxSize        int64    `yaml:"maxSize"`
+	Types          []string `yaml:"types"`
+	IDsFile        string   `yaml:"idsFile"`
+}
+
+// RetryConfig configures how transient errors from the stores and the database are retried
+type RetryConfig struct {
+	MaxAttempts int      `yaml:"maxAttempts"`
+	BaseBackoff string   `yaml:"baseBackoff"`
+	MaxBackoff  string   `yaml:"maxBackoff"`
+	Jitter      *float64 `yaml:"jitter"`
 }
 
 // DatabaseConfig configuration to connect to database
@@ -32,6 +63,9 @@ type MigrateTarget struct {
 	GoogleStorage MigrateTargetGoogleStorage `yaml:"GoogleStorage"`
 	AmazonS3      MigrateTargetS3            `yaml:"AmazonS3"`
 	FileSystem    MigrateTargetFileSystem    `yaml:"FileSystem"`
+	AzureBlob     MigrateTargetAzure         `yaml:"AzureBlob"`
+	Webdav        MigrateTargetWebdav        `yaml:"Webdav"`
+	SFTP          MigrateTargetSFTP          `yaml:"SFTP"`
 }
 
 type MigrateTargetGoogleStorage struct {
@@ -48,6 +82,36 @@ type MigrateTargetS3 struct {
 	UseSSL    bool   `yaml:"useSSL"`
 }
 
+// MigrateTargetAzure configures an Azure Blob Storage container, authenticated with either the account key or a SAS token
+type MigrateTargetAzure struct {
+	Account    string `yaml:"account"`
+	AccountKey string `yaml:"accountKey"`
+	SASToken   string `yaml:"sasToken"`
+	Container  string `yaml:"container"`
+	Endpoint   string `yaml:"endpoint"`
+}
+
+// MigrateTargetWebdav configures a WebDAV server, the files being kept in its upload folder
+type MigrateTargetWebdav struct {
+	ServerURL        string `yaml:"serverUrl"`
+	Username         string `yaml:"username"`
+	Password         string `yaml:"password"`
+	UploadFolderPath string `yaml:"uploadFolderPath"`
+}
+
+// MigrateTargetSFTP configures a directory on a server reachable over SSH, authenticated with a private key, a password or the default keys of ~/.ssh
+type MigrateTargetSFTP struct {
+	Host                  string `yaml:"host"`
+	Port                  int    `yaml:"port"`
+	User                  string `yaml:"user"`
+	Password              string `yaml:"password"`
+	KeyFile               string `yaml:"keyFile"`
+	KeyPassphrase         string `yaml:"keyPassphrase"`
+	KnownHostsFile        string `yaml:"knownHostsFile"`
+	InsecureIgnoreHostKey bool   `yaml:"insecureIgnoreHostKey"`
+	Location              string `yaml:"location"`
+}
+
 type MigrateTargetFileSystem struct {
 	Location string `yaml:"location"`
 }
@@ -61,13 +125,11 @@ func Get() *Config {
 func (c *Config) Load(filePath string) error {
 	yamlFile, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Printf("yamlFile.Get err   #%v ", err)
-		return err
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 	}
 
 	if err := yaml.Unmarshal(yamlFile, c); err != nil {
-		log.Fatalf("Unmarshal: %v", err)
-		return err
+		return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, filePath, err)
 	}
 
 	return nil
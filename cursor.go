@@ -0,0 +1,188 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultBatchSize is the number of documents fetched from the database at a time unless the
+// configuration or SetBatchSize say otherwise
+const defaultBatchSize = 1000
+
+// fileProjection only keeps the fields decoded into rocketchat.File, it must be kept in sync with it
+var fileProjection = bson.M{
+	"_id":           1,
+	"name":          1,
+	"size":          1,
+	"type":          1,
+	"rid":           1,
+	"userId":        1,
+	"description":   1,
+	"store":         1,
+	"complete":      1,
+	"uploading":     1,
+	"extension":     1,
+	"progress":      1,
+	"AmazonS3":      1,
+	"GoogleStorage": 1,
+	"AzureBlob":     1,
+	"Webdav":        1,
+	"_updatedAt":    1,
+	"instanceId":    1,
+	"identify":      1,
+	"etag":          1,
+	"token":         1,
+	"uploadedAt":    1,
+	"path":          1,
+	"url":           1,
+	"isroomavatar":  1,
+}
+
+// fileIterator yields the files to be processed one at a time
+type fileIterator interface {
+	// total returns the number of files expected, used to report the progress
+	total() int
+	// next returns the next file, or false once there are none left
+	next(ctx context.Context) (rocketchat.File, bool, error)
+}
+
+// documentIterator yields raw documents one at a time
+type documentIterator interface {
+	// next returns the next document, or false once there are none left
+	next(ctx context.Context) (bson.Raw, bool, error)
+}
+
+// batchCursor reads the documents matching query in the order of the find options, batchSize at a
+// time. Each batch is fetched with a new query starting after the last document of the previous one,
+// so no cursor is left open on the server, where it would time out, while the documents are processed
+type batchCursor struct {
+	collection *mongo.Collection
+	query      bson.M
+	options    *options.FindOptions
+	// after returns the condition selecting the documents that come after last in the sort order
+	after     func(last bson.Raw) bson.M
+	batchSize int
+
+	batch []bson.Raw
+	last  bson.Raw
+	done  bool
+}
+
+func (c *batchCursor) next(ctx context.Context) (bson.Raw, bool, error) {
+	if len(c.batch) == 0 {
+		if c.done {
+			return nil, false, nil
+		}
+
+		if err := c.fetch(ctx); err != nil {
+			return nil, false, err
+		}
+
+		if len(c.batch) == 0 {
+			return nil, false, nil
+		}
+	}
+
+	c.last = c.batch[0]
+	c.batch = c.batch[1:]
+
+	return c.last, true, nil
+}
+
+// fetch reads the batch following the last document returned
+func (c *batchCursor) fetch(ctx context.Context) error {
+	query := c.query
+	if c.last != nil {
+		query = bson.M{"$and": []bson.M{c.query, c.after(c.last)}}
+	}
+
+	cursor, err := c.collection.Find(ctx, query, c.options, options.Find().SetLimit(int64(c.batchSize)))
+	if err == nil {
+		err = cursor.All(ctx, &c.batch)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	c.done = len(c.batch) < c.batchSize
+
+	return nil
+}
+
+// fileSort is the order the files are processed in, the most recent upload first
+var fileSort = bson.D{{Key: "uploadedAt", Value: -1}, {Key: "_id", Value: -1}}
+
+// afterFile returns the condition selecting the files that come after last in the fileSort order.
+// The files without upload date come last, ordered by id alone
+func afterFile(last bson.Raw) bson.M {
+	id := last.Lookup("_id")
+
+	uploadedAt, err := last.LookupErr("uploadedAt")
+	if err != nil || uploadedAt.Type == bson.TypeNull {
+		return bson.M{"uploadedAt": nil, "_id": bson.M{"$lt": id}}
+	}
+
+	return bson.M{"$or": []bson.M{
+		{"uploadedAt": bson.M{"$lt": uploadedAt}},
+		{"uploadedAt": uploadedAt, "_id": bson.M{"$lt": id}},
+		{"uploadedAt": nil},
+	}}
+}
+
+// afterID returns the condition selecting the documents that come after last in the order of their id
+func afterID(last bson.Raw) bson.M {
+	return bson.M{"_id": bson.M{"$gt": last.Lookup("_id")}}
+}
+
+// fileCursor iterates over the documents of a file collection, fetching them in batches so
+// the memory used doesn't depend on the number of files
+type fileCursor struct {
+	documents documentIterator
+	count     int
+	bytes     int64
+}
+
+func (c *fileCursor) total() int {
+	return c.count
+}
+
+// totalBytes returns the sum of the sizes of the files, counted along with total
+func (c *fileCursor) totalBytes() int64 {
+	return c.bytes
+}
+
+func (c *fileCursor) next(ctx context.Context) (rocketchat.File, bool, error) {
+	var file rocketchat.File
+
+	document, ok, err := c.documents.next(ctx)
+	if err != nil || !ok {
+		return file, false, err
+	}
+
+	if err := bson.Unmarshal(document, &file); err != nil {
+		return file, false, err
+	}
+
+	return file, true, nil
+}
+
+// SetBatchSize sets the number of documents fetched from the database at a time
+func (m *Migrate) SetBatchSize(batchSize int) error {
+	if batchSize < 1 {
+		return fmt.Errorf("%w: batch size must be at least 1", ErrInvalidConfig)
+	}
+
+	m.batchSize = batchSize
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// documentSlice iterates over documents already in memory
+type documentSlice []bson.Raw
+
+func (s *documentSlice) next(ctx context.Context) (bson.Raw, bool, error) {
+	if len(*s) == 0 {
+		return nil, false, nil
+	}
+
+	document := (*s)[0]
+	*s = (*s)[1:]
+
+	return document, true, nil
+}
+
+// newDocumentSlice marshals the documents into a documentSlice
+func newDocumentSlice(t *testing.T, documents ...interface{}) *documentSlice {
+	t.Helper()
+
+	var slice documentSlice
+
+	for _, document := range documents {
+		raw, err := bson.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slice = append(slice, raw)
+	}
+
+	return &slice
+}
+
+func TestFileCursor(t *testing.T) {
+	uploadedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	files := &fileCursor{
+		documents: newDocumentSlice(t,
+			bson.M{"_id": "file1", "name": "photo.png", "size": 42, "store": "GridFS:Uploads", "uploadedAt": uploadedAt},
+			bson.M{"_id": "file2", "name": "notes.txt", "size": 5, "store": "GridFS:Uploads", "AmazonS3": bson.M{"path": "unique/uploads/room/user/file2"}},
+		),
+		count: 2,
+		bytes: 47,
+	}
+
+	want := []rocketchat.File{
+		{ID: "file1", Name: "photo.png", Size: 42, Store: "GridFS:Uploads", UploadedAt: uploadedAt},
+		{ID: "file2", Name: "notes.txt", Size: 5, Store: "GridFS:Uploads", AmazonS3: rocketchat.AmazonS3{Path: "unique/uploads/room/user/file2"}},
+	}
+
+	var got []rocketchat.File
+
+	for {
+		file, ok, err := files.next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			break
+		}
+
+		got = append(got, file)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("files = %+v, want %+v", got, want)
+	}
+
+	if files.total() != 2 || files.totalBytes() != 47 {
+		t.Fatalf("total = %d files and %d bytes, want 2 files and 47 bytes", files.total(), files.totalBytes())
+	}
+}
+
+func TestAfterFile(t *testing.T) {
+	uploadedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		last bson.M
+		want string
+	}{
+		{
+			name: "dated file",
+			last: bson.M{"_id": "file1", "uploadedAt": uploadedAt},
+			want: `{"$or":[{"uploadedAt":{"$lt":{"$date":"2024-03-01T00:00:00Z"}}},{"_id":{"$lt":"file1"},"uploadedAt":{"$date":"2024-03-01T00:00:00Z"}},{"uploadedAt":null}]}`,
+		},
+		{
+			name: "file without upload date",
+			last: bson.M{"_id": "file1"},
+			want: `{"_id":{"$lt":"file1"},"uploadedAt":null}`,
+		},
+		{
+			name: "file with a null upload date",
+			last: bson.M{"_id": "file1", "uploadedAt": nil},
+			want: `{"_id":{"$lt":"file1"},"uploadedAt":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last, err := bson.Marshal(tt.last)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := bson.MarshalExtJSON(afterFile(last), false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !sameJSON(t, got, tt.want) {
+				t.Fatalf("afterFile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAfterID(t *testing.T) {
+	last, err := bson.Marshal(bson.M{"_id": "backup1", "fileId": "file1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := bson.MarshalExtJSON(afterID(last), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"_id":{"$gt":"backup1"}}`; !sameJSON(t, got, want) {
+		t.Fatalf("afterID() = %s, want %s", got, want)
+	}
+}
+
+// sameJSON reports whether the JSON documents are equal regardless of the order of their keys
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	var gotValue, wantValue interface{}
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+
+	return reflect.DeepEqual(gotValue, wantValue)
+}
@@ -0,0 +1,196 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetDeleteSource makes MigrateStore remove the source copy of the files migrated more than the
+// DeleteSourceAfter grace period ago once it is done
+func (m *Migrate) SetDeleteSource(deleteSource bool) {
+	m.deleteSource = deleteSource
+}
+
+// SetDeleteSourceAfter sets the grace period after which the source copy of a migrated file is removed.
+// A zero gracePeriod removes them as soon as they are migrated
+func (m *Migrate) SetDeleteSourceAfter(gracePeriod time.Duration) {
+	m.deleteSourceAfter = gracePeriod
+}
+
+// DeleteSourceAfter returns the grace period after which the source copy of a migrated file is removed
+func (m *Migrate) DeleteSourceAfter() time.Duration {
+	return m.deleteSourceAfter
+}
+
+// DeleteSources removes from the source store the original copy of every file migrated more than olderThan ago.
+// Files are found through the backups saved by the runs, and a copy is only removed when the file document
+// still points at the destination store, passes the filter and the object there has the size recorded in the database
+func (m *Migrate) DeleteSources(ctx context.Context, olderThan time.Duration) error {
+	if m.sourceStore == nil || m.destinationStore == nil {
+		return fmt.Errorf("%w: For DeleteSources both a source and destination store must be provided", ErrInvalidConfig)
+	}
+
+	fileCollection, err := m.collectionName()
+	if err != nil {
+		return err
+	}
+
+	backupCollection, err := m.backupCollectionName()
+	if err != nil {
+		return err
+	}
+
+	m.fileCollectionName = fileCollection
+
+	session, err := connectDB(ctx, m.connectionString)
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(context.Background())
+
+	db := session.Client().Database(m.databaseName)
+
+	backups := db.Collection(backupCollection)
+	documents := db.Collection(fileCollection)
+
+	sourceStore := m.sourceStore.StoreType() + ":" + m.storeName
+
+	// only the files still on the destination and passing the filter are removed from the source
+	destinationQuery := m.fileQuery(m.destinationStore.StoreType())
+
+	query := deletableBackupsQuery(sourceStore, olderThan, time.Now())
+
+	total, err := backups.CountDocuments(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	// the backups are read in batches as the files are deleted, like the files of a run
+	backupDocuments := &batchCursor{
+		collection: backups,
+		query:      query,
+		options:    options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+		after:      afterID,
+		batchSize:  m.batchSize,
+	}
+
+	files := &sourceCursor{documents: backupDocuments, count: int(total), seen: make(map[string]bool)}
+
+	m.debugLog(fmt.Sprintf("Found %v backups of files migrated from %s before %s\n", total, sourceStore, time.Now().Add(-olderThan).Format(time.RFC3339)))
+
+	var deleted int64
+
+	err = m.processFiles(ctx, files, func(index int, original rocketchat.File) error {
+		event := fileEvent{Index: index, Total: files.total(), File: original, Phase: eventSkip}
+
+		var current rocketchat.File
+
+		selected := bson.M{"$and": []bson.M{destinationQuery, {"_id": original.ID}}}
+
+		if err := documents.FindOne(ctx, selected).Decode(&current); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				m.logFileEvent(slog.LevelDebug, "File was moved, removed or filtered out, skipping", event)
+				return nil
+			}
+
+			return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+
+		size, err := m.destinationStore.Stat(ctx, fileCollection, current)
+		if err != nil || size != int64(current.Size) {
+			event.Err = err
+			m.logFileEvent(slog.LevelWarn, "Unable to verify file on the destination, skipping", event)
+
+			return nil
+		}
+
+		event.Phase = eventDelete
+		event.Bytes = size
+		m.logFileEvent(slog.LevelDebug, "Deleting file from source", event)
+
+		if err := m.sourceStore.Delete(ctx, fileCollection, original, true); err != nil {
+			event.Err = err
+
+			if m.skipErrors {
+				m.logFileEvent(slog.LevelWarn, "Failed to delete file from source, skipping", event)
+				return nil
+			}
+
+			m.logFileEvent(slog.LevelError, "Failed to delete file from source", event)
+
+			return fmt.Errorf("%w: %w", ErrSourceUnreachable, err)
+		}
+
+		if _, err := backups.UpdateMany(ctx, bson.M{"fileId": original.ID, "store": sourceStore}, bson.M{"$set": bson.M{"sourceDeletedAt": time.Now()}}); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+
+		atomic.AddInt64(&deleted, 1)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.debugLog(fmt.Sprintf("Deleted %v of %v files from: %s\n", deleted, len(files.seen), m.sourceStore.StoreType()))
+
+	return nil
+}
+
+// deletableBackupsQuery selects the backups of the files migrated from sourceStore more than olderThan
+// before now which were neither rolled back nor deleted from the source yet
+func deletableBackupsQuery(sourceStore string, olderThan time.Duration, now time.Time) bson.M {
+	return bson.M{
+		"store":           sourceStore,
+		"createdAt":       bson.M{"$lte": now.Add(-olderThan)},
+		"restoredAt":      bson.M{"$exists": false},
+		"sourceDeletedAt": bson.M{"$exists": false},
+	}
+}
+
+// sourceCursor iterates over the backups of the files migrated from the source store, returning every
+// file once with the location fields it had there
+type sourceCursor struct {
+	documents documentIterator
+	count     int
+	// a file can be backed up more than once when a run is resumed
+	seen map[string]bool
+}
+
+func (c *sourceCursor) total() int {
+	return c.count
+}
+
+func (c *sourceCursor) next(ctx context.Context) (rocketchat.File, bool, error) {
+	for {
+		document, ok, err := c.documents.next(ctx)
+		if err != nil || !ok {
+			return rocketchat.File{}, false, err
+		}
+
+		var backup fileBackup
+
+		if err := bson.Unmarshal(document, &backup); err != nil {
+			return rocketchat.File{}, false, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+
+		if c.seen[backup.FileID] {
+			continue
+		}
+
+		c.seen[backup.FileID] = true
+
+		return backup.sourceFile(rocketchat.File{}), true, nil
+	}
+}
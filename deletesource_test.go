@@ -0,0 +1,78 @@
+package migrator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDeletableBackupsQuery(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		want      time.Time
+	}{
+		{name: "right away", want: now},
+		{name: "grace period", olderThan: 720 * time.Hour, want: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := deletableBackupsQuery("GridFS:Uploads", tt.olderThan, now)
+
+			want := bson.M{
+				"store":           "GridFS:Uploads",
+				"createdAt":       bson.M{"$lte": tt.want},
+				"restoredAt":      bson.M{"$exists": false},
+				"sourceDeletedAt": bson.M{"$exists": false},
+			}
+
+			if !reflect.DeepEqual(query, want) {
+				t.Fatalf("deletableBackupsQuery() = %v, want %v", query, want)
+			}
+		})
+	}
+}
+
+func TestSourceCursor(t *testing.T) {
+	// file1 was backed up twice by a resumed run
+	files := &sourceCursor{
+		documents: newDocumentSlice(t,
+			fileBackup{FileID: "file1", Store: "AmazonS3:Uploads", AmazonS3: &rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"}},
+			fileBackup{FileID: "file2", Store: "AmazonS3:Uploads", AmazonS3: &rocketchat.AmazonS3{Path: "unique/uploads/room/user/file2"}},
+			fileBackup{FileID: "file1", Store: "AmazonS3:Uploads", AmazonS3: &rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"}},
+		),
+		count: 3,
+		seen:  make(map[string]bool),
+	}
+
+	want := []rocketchat.File{
+		{ID: "file1", Store: "AmazonS3:Uploads", AmazonS3: rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"}},
+		{ID: "file2", Store: "AmazonS3:Uploads", AmazonS3: rocketchat.AmazonS3{Path: "unique/uploads/room/user/file2"}},
+	}
+
+	var got []rocketchat.File
+
+	for {
+		file, ok, err := files.next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			break
+		}
+
+		got = append(got, file)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("files = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,20 @@
+package migrator
+
+import (
+	"errors"
+
+	"github.com/RocketChat/filestore-migrator/config"
+)
+
+// Classes of the errors returned by the migrator. They are wrapped with the details of what
+// failed so errors.Is has to be used to check for them
+var (
+	// ErrInvalidConfig is returned when the configuration or an option is missing or invalid
+	ErrInvalidConfig = config.ErrInvalidConfig
+	// ErrDatabaseUnreachable is returned when the Rocket.Chat database can't be reached
+	ErrDatabaseUnreachable = errors.New("database unreachable")
+	// ErrSourceUnreachable is returned when a file can't be read from the source store
+	ErrSourceUnreachable = errors.New("source store unreachable")
+	// ErrDestinationUnreachable is returned when a file can't be written to the destination store
+	ErrDestinationUnreachable = errors.New("destination store unreachable")
+)
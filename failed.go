@@ -0,0 +1,232 @@
+package migrator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ActionRetryFailed is the action of the reports produced by RetryFailed
+const ActionRetryFailed = "retry-failed"
+
+// failedEntry is a line of the failed list recording a file a run couldn't process
+type failedEntry struct {
+	ID     string    `json:"id"`
+	Name   string    `json:"name,omitempty"`
+	Store  string    `json:"store"`
+	Action string    `json:"action"`
+	RunID  string    `json:"runId"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// FailedListPath returns the path of the JSONL list every file failing in a migrate, download or
+// upload run is written to. It only holds the failures of the last run on each store
+func (m *Migrate) FailedListPath() string {
+	return m.tempFileLocation + "/failed.jsonl"
+}
+
+// resetFailed removes from the failed list the entries of the current store and action whose file
+// the run about to start selects, as it processes those files again. The entries of the files left out
+// by the filter, of the other stores and of the other actions are kept
+func (m *Migrate) resetFailed(ctx context.Context, action string) error {
+	ids, err := readFailedList(m.FailedListPath(), m.storeName, action)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := bson.M{"$and": []bson.M{
+		m.fileQuery(m.sourceStore.StoreType()),
+		{"_id": bson.M{"$in": ids}},
+	}}
+
+	collection := m.session.Client().Database(m.databaseName).Collection(m.fileCollectionName)
+
+	cursor, err := collection.Find(ctx, query, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	var selected []struct {
+		ID string `bson:"_id"`
+	}
+
+	if err := cursor.All(ctx, &selected); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	reset := make(map[string]bool, len(selected))
+	for _, file := range selected {
+		reset[file.ID] = true
+	}
+
+	m.failedMu.Lock()
+	defer m.failedMu.Unlock()
+
+	return removeFailedEntries(m.FailedListPath(), m.storeName, action, reset)
+}
+
+// removeFailedEntries rewrites the failed list at path without the entries of the store and action for the given ids
+func removeFailedEntries(path string, storeName string, action string, ids map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var kept bytes.Buffer
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var entry failedEntry
+		if err := json.Unmarshal(line, &entry); err == nil && entry.Store == storeName && entry.Action == action && ids[entry.ID] {
+			continue
+		}
+
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, kept.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// recordFailed adds the file to the failures of the report and appends it to the failed list
+func (m *Migrate) recordFailed(report *Report, file rocketchat.File, err error) {
+	report.addFailed(file, err)
+
+	entry := failedEntry{
+		ID:     file.ID,
+		Name:   file.Name,
+		Store:  m.storeName,
+		Action: report.Action,
+		RunID:  report.RunID,
+		Error:  err.Error(),
+		Time:   time.Now(),
+	}
+
+	line, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		m.infoLog("Failed to record failed file:", jsonErr)
+		return
+	}
+
+	m.failedMu.Lock()
+	defer m.failedMu.Unlock()
+
+	f, openErr := os.OpenFile(m.FailedListPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if openErr != nil {
+		m.infoLog("Failed to record failed file:", openErr)
+		return
+	}
+
+	defer f.Close()
+
+	if _, writeErr := f.Write(append(line, '\n')); writeErr != nil {
+		m.infoLog("Failed to record failed file:", writeErr)
+	}
+}
+
+// readFailedList returns the ids of the files of the store the given action failed on listed in the failed list at path
+func readFailedList(path string, storeName string, action string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var ids []string
+
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var entry failedEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%w: %s line %d: %w", ErrInvalidConfig, path, line, err)
+		}
+
+		if entry.Store != storeName || entry.Action != action || entry.ID == "" || seen[entry.ID] {
+			continue
+		}
+
+		seen[entry.ID] = true
+		ids = append(ids, entry.ID)
+	}
+
+	return ids, scanner.Err()
+}
+
+// RetryFailed migrates again the files of the current store listed in the failed list at path,
+// defaulting to FailedListPath, without going through the rest of the store. Only the files a
+// migration failed on and whose document still references the source store are processed. The
+// journal of the store is resumed, so the retries carry on the run the files failed in
+func (m *Migrate) RetryFailed(ctx context.Context, path string) (*Report, error) {
+	if path == "" {
+		path = m.FailedListPath()
+	}
+
+	ids, err := readFailedList(path, m.storeName, ActionMigrate)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: failed list %s not found", ErrInvalidConfig, path)
+		}
+
+		return nil, err
+	}
+
+	m.infoLog(fmt.Sprintf("Found %v failed files of %s in %s", len(ids), m.storeName, path))
+
+	if len(ids) == 0 {
+		report := m.newReport(ActionRetryFailed, 0, 0)
+		report.finish()
+
+		return report, nil
+	}
+
+	m.fileIDs = ids
+	defer func() { m.fileIDs = nil }()
+
+	// a fresh journal would drop the progress of the files that are not retried
+	resume := m.resume
+	m.resume = true
+
+	defer func() { m.resume = resume }()
+
+	report, err := m.MigrateStore(ctx)
+	if report != nil {
+		report.Action = ActionRetryFailed
+	}
+
+	return report, err
+}
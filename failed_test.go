@@ -0,0 +1,130 @@
+package migrator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadFailedList(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		store    string
+		action   string
+		want     []string
+		wantErr  error
+	}{
+		{
+			name: "keeps the files of the store and action",
+			contents: `{"id":"a","store":"Uploads","action":"migrate"}
+{"id":"b","store":"Avatars","action":"migrate"}
+{"id":"c","store":"Uploads","action":"download"}
+{"id":"d","store":"Uploads","action":"migrate"}
+`,
+			store:  "Uploads",
+			action: ActionMigrate,
+			want:   []string{"a", "d"},
+		},
+		{
+			name: "drops duplicates and entries without id",
+			contents: `{"id":"a","store":"Uploads","action":"migrate"}
+{"id":"","store":"Uploads","action":"migrate"}
+{"id":"a","store":"Uploads","action":"migrate"}
+`,
+			store:  "Uploads",
+			action: ActionMigrate,
+			want:   []string{"a"},
+		},
+		{
+			name:     "skips blank lines",
+			contents: "\n{\"id\":\"a\",\"store\":\"Uploads\",\"action\":\"migrate\"}\n   \n",
+			store:    "Uploads",
+			action:   ActionMigrate,
+			want:     []string{"a"},
+		},
+		{
+			name:     "nothing for the store",
+			contents: `{"id":"a","store":"Avatars","action":"migrate"}` + "\n",
+			store:    "Uploads",
+			action:   ActionMigrate,
+		},
+		{
+			name:     "invalid line",
+			contents: `{"id":"a","store":"Uploads","action":"migrate"}` + "\nnot json\n",
+			store:    "Uploads",
+			action:   ActionMigrate,
+			wantErr:  ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "failed.jsonl")
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ids, err := readFailedList(path, tt.store, tt.action)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Fatalf("ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFailedListMissing(t *testing.T) {
+	_, err := readFailedList(filepath.Join(t.TempDir(), "failed.jsonl"), "Uploads", ActionMigrate)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestRemoveFailedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.jsonl")
+
+	contents := `{"id":"a","store":"Uploads","action":"migrate"}
+{"id":"b","store":"Uploads","action":"migrate"}
+{"id":"a","store":"Avatars","action":"migrate"}
+{"id":"a","store":"Uploads","action":"download"}
+
+{"id":"c","store":"Uploads","action":"migrate"}
+`
+
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeFailedEntries(path, "Uploads", ActionMigrate, map[string]bool{"a": true, "c": true}); err != nil {
+		t.Fatalf("removeFailedEntries() = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":"b","store":"Uploads","action":"migrate"}
+{"id":"a","store":"Avatars","action":"migrate"}
+{"id":"a","store":"Uploads","action":"download"}
+`
+
+	if string(data) != want {
+		t.Fatalf("failed list = %q, want %q", data, want)
+	}
+}
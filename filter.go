@@ -0,0 +1,269 @@
+package migrator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Filter restricts the files processed to those matching every field set
+type Filter struct {
+	// Rids only keeps files uploaded to one of these rooms
+	Rids []string
+	// UserIDs only keeps files uploaded by one of these users
+	UserIDs []string
+	// UploadedAfter only keeps files uploaded at or after this time
+	UploadedAfter time.Time
+	// UploadedBefore only keeps files uploaded before this time
+	UploadedBefore time.Time
+	// MinSize only keeps files of at least this many bytes
+	MinSize int64
+	// MaxSize only keeps files of at most this many bytes, 0 means no limit
+	MaxSize int64
+	// Types only keeps files whose MIME type matches one of these globs, such as image/*
+	Types []string
+	// IDs only keeps the files with these ids
+	IDs []string
+}
+
+// validate checks the values of the filter make sense
+func (f Filter) validate() error {
+	if f.MinSize < 0 || f.MaxSize < 0 {
+		return fmt.Errorf("%w: filter sizes must be positive", ErrInvalidConfig)
+	}
+
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("%w: filter minSize must be no greater than maxSize", ErrInvalidConfig)
+	}
+
+	if !f.UploadedAfter.IsZero() && !f.UploadedBefore.IsZero() && !f.UploadedAfter.Before(f.UploadedBefore) {
+		return fmt.Errorf("%w: filter uploadedAfter must be before uploadedBefore", ErrInvalidConfig)
+	}
+
+	for _, typ := range f.Types {
+		if typ == "" {
+			return fmt.Errorf("%w: filter types can't be empty", ErrInvalidConfig)
+		}
+	}
+
+	return nil
+}
+
+// apply adds the conditions of the filter to the query on the file collection
+func (f Filter) apply(query bson.M) {
+	if len(f.Rids) > 0 {
+		query["rid"] = bson.M{"$in": f.Rids}
+	}
+
+	if len(f.UserIDs) > 0 {
+		query["userId"] = bson.M{"$in": f.UserIDs}
+	}
+
+	uploadedAt := bson.M{}
+	if !f.UploadedAfter.IsZero() {
+		uploadedAt["$gte"] = f.UploadedAfter
+	}
+
+	if !f.UploadedBefore.IsZero() {
+		uploadedAt["$lt"] = f.UploadedBefore
+	}
+
+	if len(uploadedAt) > 0 {
+		query["uploadedAt"] = uploadedAt
+	}
+
+	size := bson.M{}
+	if f.MinSize > 0 {
+		size["$gte"] = f.MinSize
+	}
+
+	if f.MaxSize > 0 {
+		size["$lte"] = f.MaxSize
+	}
+
+	if len(size) > 0 {
+		query["size"] = size
+	}
+
+	if len(f.Types) > 0 {
+		types := make([]interface{}, 0, len(f.Types))
+		for _, typ := range f.Types {
+			types = append(types, globRegex(typ))
+		}
+
+		query["type"] = bson.M{"$in": types}
+	}
+
+	if len(f.IDs) > 0 {
+		query["_id"] = bson.M{"$in": f.IDs}
+	}
+}
+
+// globRegex turns a glob where * matches any run of characters and ? a single one into an
+// anchored, case insensitive regular expression
+func globRegex(glob string) primitive.Regex {
+	var pattern strings.Builder
+
+	pattern.WriteString("^")
+
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	pattern.WriteString("$")
+
+	return primitive.Regex{Pattern: pattern.String(), Options: "i"}
+}
+
+// ParseFilterTime parses a time given either as RFC 3339 or as a 2006-01-02 date, taken as UTC midnight
+func ParseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// ReadIDsFile returns the file ids listed one per line in the file at path, ignoring blank lines
+// and lines starting with #
+func ReadIDsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	defer f.Close()
+
+	var ids []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" || strings.HasPrefix(id, "#") {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+	}
+
+	return ids, nil
+}
+
+// parseFilterConfig returns the filter described by the configuration
+func parseFilterConfig(filterConfig config.FilterConfig) (Filter, error) {
+	filter := Filter{
+		Rids:    filterConfig.Rids,
+		UserIDs: filterConfig.UserIDs,
+		MinSize: filterConfig.MinSize,
+		MaxSize: filterConfig.MaxSize,
+		Types:   filterConfig.Types,
+	}
+
+	if filterConfig.UploadedAfter != "" {
+		after, err := ParseFilterTime(filterConfig.UploadedAfter)
+		if err != nil {
+			return filter, fmt.Errorf("%w: invalid filter uploadedAfter value: %w", ErrInvalidConfig, err)
+		}
+
+		filter.UploadedAfter = after
+	}
+
+	if filterConfig.UploadedBefore != "" {
+		before, err := ParseFilterTime(filterConfig.UploadedBefore)
+		if err != nil {
+			return filter, fmt.Errorf("%w: invalid filter uploadedBefore value: %w", ErrInvalidConfig, err)
+		}
+
+		filter.UploadedBefore = before
+	}
+
+	if filterConfig.IDsFile != "" {
+		ids, err := ReadIDsFile(filterConfig.IDsFile)
+		if err != nil {
+			return filter, err
+		}
+
+		filter.IDs = ids
+	}
+
+	return filter, filter.validate()
+}
+
+// SetFilter sets which files of the store are processed
+func (m *Migrate) SetFilter(filter Filter) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+
+	m.filter = filter
+
+	return nil
+}
+
+// Filter returns the filter in use
+func (m *Migrate) Filter() Filter {
+	return m.filter
+}
+
+// fileQuery returns the query selecting the files of the store to be processed
+func (m *Migrate) fileQuery(storeType string) bson.M {
+	query := bson.M{"store": storeType + ":" + m.storeName}
+
+	filter := m.filter
+
+	if !m.fileOffset.IsZero() && m.fileOffset.After(filter.UploadedAfter) {
+		filter.UploadedAfter = m.fileOffset
+	}
+
+	if len(m.fileIDs) > 0 {
+		filter.IDs = intersectIDs(filter.IDs, m.fileIDs)
+	}
+
+	filter.apply(query)
+
+	if len(m.fileIDs) > 0 && len(filter.IDs) == 0 {
+		// None of the ids asked for pass the filter
+		query["_id"] = bson.M{"$in": []string{}}
+	}
+
+	return query
+}
+
+// intersectIDs returns the ids of b also in a, or b when a is empty
+func intersectIDs(a []string, b []string) []string {
+	if len(a) == 0 {
+		return b
+	}
+
+	inA := make(map[string]bool, len(a))
+	for _, id := range a {
+		inA[id] = true
+	}
+
+	ids := []string{}
+	for _, id := range b {
+		if inA[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,144 @@
+package migrator
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGlobRegex(t *testing.T) {
+	tests := []struct {
+		glob     string
+		pattern  string
+		matches  []string
+		rejected []string
+	}{
+		{
+			glob:     "image/*",
+			pattern:  `^image/.*$`,
+			matches:  []string{"image/png", "image/", "IMAGE/JPEG"},
+			rejected: []string{"video/mp4", "application/image/png"},
+		},
+		{
+			glob:     "image/?ng",
+			pattern:  `^image/.ng$`,
+			matches:  []string{"image/png"},
+			rejected: []string{"image/ng", "image/jpeg"},
+		},
+		{
+			glob:     "application/vnd.ms-excel",
+			pattern:  `^application/vnd\.ms-excel$`,
+			matches:  []string{"application/vnd.ms-excel"},
+			rejected: []string{"application/vndxms-excel", "application/vnd.ms-excel.sheet"},
+		},
+		{
+			glob:     "text/x-c++",
+			pattern:  `^text/x-c\+\+$`,
+			matches:  []string{"text/x-c++"},
+			rejected: []string{"text/x-cc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			regex := globRegex(tt.glob)
+
+			if regex.Pattern != tt.pattern || regex.Options != "i" {
+				t.Fatalf("globRegex(%q) = %q /%s, want %q /i", tt.glob, regex.Pattern, regex.Options, tt.pattern)
+			}
+
+			compiled := regexp.MustCompile("(?i)" + regex.Pattern)
+
+			for _, value := range tt.matches {
+				if !compiled.MatchString(value) {
+					t.Errorf("%q doesn't match %q", value, tt.glob)
+				}
+			}
+
+			for _, value := range tt.rejected {
+				if compiled.MatchString(value) {
+					t.Errorf("%q matches %q", value, tt.glob)
+				}
+			}
+		})
+	}
+}
+
+func TestFileQuery(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	offset := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		migrate *Migrate
+		want    bson.M
+	}{
+		{
+			name:    "no filter",
+			migrate: &Migrate{storeName: "Uploads"},
+			want:    bson.M{"store": "AmazonS3:Uploads"},
+		},
+		{
+			name: "every field",
+			migrate: &Migrate{storeName: "Uploads", filter: Filter{
+				Rids:           []string{"room1"},
+				UserIDs:        []string{"user1", "user2"},
+				UploadedAfter:  after,
+				UploadedBefore: before,
+				MinSize:        10,
+				MaxSize:        1000,
+				Types:          []string{"image/*"},
+				IDs:            []string{"file1"},
+			}},
+			want: bson.M{
+				"store":      "AmazonS3:Uploads",
+				"rid":        bson.M{"$in": []string{"room1"}},
+				"userId":     bson.M{"$in": []string{"user1", "user2"}},
+				"uploadedAt": bson.M{"$gte": after, "$lt": before},
+				"size":       bson.M{"$gte": int64(10), "$lte": int64(1000)},
+				"type":       bson.M{"$in": []interface{}{primitive.Regex{Pattern: `^image/.*$`, Options: "i"}}},
+				"_id":        bson.M{"$in": []string{"file1"}},
+			},
+		},
+		{
+			name:    "offset after the filter",
+			migrate: &Migrate{storeName: "Uploads", fileOffset: offset, filter: Filter{UploadedAfter: after}},
+			want:    bson.M{"store": "AmazonS3:Uploads", "uploadedAt": bson.M{"$gte": offset}},
+		},
+		{
+			name:    "offset before the filter",
+			migrate: &Migrate{storeName: "Uploads", fileOffset: after, filter: Filter{UploadedAfter: offset}},
+			want:    bson.M{"store": "AmazonS3:Uploads", "uploadedAt": bson.M{"$gte": offset}},
+		},
+		{
+			name:    "retried ids",
+			migrate: &Migrate{storeName: "Uploads", fileIDs: []string{"file1", "file2"}},
+			want:    bson.M{"store": "AmazonS3:Uploads", "_id": bson.M{"$in": []string{"file1", "file2"}}},
+		},
+		{
+			name:    "retried ids within the filter",
+			migrate: &Migrate{storeName: "Uploads", fileIDs: []string{"file1", "file2"}, filter: Filter{IDs: []string{"file2", "file3"}}},
+			want:    bson.M{"store": "AmazonS3:Uploads", "_id": bson.M{"$in": []string{"file2"}}},
+		},
+		{
+			name:    "retried ids outside the filter",
+			migrate: &Migrate{storeName: "Uploads", fileIDs: []string{"file1"}, filter: Filter{IDs: []string{"file3"}}},
+			want:    bson.M{"store": "AmazonS3:Uploads", "_id": bson.M{"$in": []string{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.migrate.fileQuery("AmazonS3")
+
+			if !reflect.DeepEqual(query, tt.want) {
+				t.Fatalf("fileQuery = %v, want %v", query, tt.want)
+			}
+		})
+	}
+}
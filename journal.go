@@ -0,0 +1,233 @@
+package migrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type journalPhase string
+
+const (
+	phaseDownloaded journalPhase = "downloaded"
+	phaseUploaded   journalPhase = "uploaded"
+	phaseDBUpdated  journalPhase = "db-updated"
+)
+
+// journalEntry is a single line of the journal recording the last phase a file reached. The
+// first line of a journal only holds the id of the run, which a resumed run carries on with
+type journalEntry struct {
+	ID         string       `json:"id,omitempty"`
+	RunID      string       `json:"runId,omitempty"`
+	Phase      journalPhase `json:"phase,omitempty"`
+	ObjectPath string       `json:"objectPath,omitempty"`
+	Time       time.Time    `json:"time"`
+}
+
+// journal is an append only JSONL checkpoint of the files processed by a run,
+// keyed by the file id so an interrupted run can be resumed
+type journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	runID   string
+	entries map[string]journalEntry
+	// partial is set when the loaded journal ends with a half written line
+	partial bool
+}
+
+// openJournal opens the journal at path. When resume is set the existing entries are
+// loaded and new ones appended, otherwise the journal is started from scratch. The run id
+// recorded in a resumed journal is kept, runID is recorded when there is none
+func openJournal(path string, resume bool, runID string) (*journal, error) {
+	j := &journal{
+		entries: make(map[string]journalEntry),
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+	if resume {
+		if err := j.load(path); err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j.file = f
+
+	// the next entries must not be appended to the half written line
+	if j.partial {
+		if _, err := f.Write([]byte("\n")); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if j.runID == "" {
+		j.runID = runID
+
+		line, err := json.Marshal(journalEntry{RunID: runID, Time: time.Now()})
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return j, nil
+}
+
+func (j *journal) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry journalEntry
+
+		// A crash can leave the last line half written, it is safe to ignore it
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+
+		if entry.ID == "" {
+			if entry.RunID != "" && j.runID == "" {
+				j.runID = entry.RunID
+			}
+
+			continue
+		}
+
+		j.entries[entry.ID] = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+			return err
+		}
+
+		j.partial = last[0] != '\n'
+	}
+
+	return nil
+}
+
+// startJournal opens the journal of the current store in the temp file location. A resumed run
+// takes over the run id of the journal so all of its backups can be rolled back at once
+func (m *Migrate) startJournal() error {
+	j, err := openJournal(m.tempFileLocation+"/"+strings.ToLower(m.storeName)+"-journal.jsonl", m.resume, m.runID)
+	if err != nil {
+		return err
+	}
+
+	if j.runID != m.runID {
+		m.infoLog("Resuming run:", j.runID)
+		m.runID = j.runID
+	}
+
+	m.journal = j
+
+	return nil
+}
+
+// stopJournal closes the journal of the current run
+func (m *Migrate) stopJournal() {
+	if err := m.journal.Close(); err != nil {
+		m.infoLog("Failed to close journal:", err)
+	}
+
+	m.journal = nil
+}
+
+// get returns the last recorded entry for the file
+func (j *journal) get(id string) (journalEntry, bool) {
+	if j == nil {
+		return journalEntry{}, false
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[id]
+
+	return entry, ok
+}
+
+// record appends the phase reached by the file to the journal
+func (j *journal) record(id string, phase journalPhase, objectPath string) error {
+	if j == nil {
+		return nil
+	}
+
+	entry := journalEntry{
+		ID:         id,
+		Phase:      phase,
+		ObjectPath: objectPath,
+		Time:       time.Now(),
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	j.entries[id] = entry
+
+	return nil
+}
+
+// Close flushes the journal to disk and closes the underlying file
+func (j *journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	if err := j.file.Sync(); err != nil {
+		j.file.Close()
+		return err
+	}
+
+	return j.file.Close()
+}
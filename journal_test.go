@@ -0,0 +1,111 @@
+package migrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenJournal(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  string
+		resume    bool
+		wantRunID string
+		wantPhase map[string]journalPhase
+	}{
+		{
+			name:      "fresh journal records the run id",
+			wantRunID: "new-run",
+			wantPhase: map[string]journalPhase{},
+		},
+		{
+			name:      "start over discards the previous journal",
+			existing:  `{"runId":"old-run"}` + "\n" + `{"id":"a","phase":"db-updated"}` + "\n",
+			wantRunID: "new-run",
+			wantPhase: map[string]journalPhase{},
+		},
+		{
+			name:      "resume keeps the run id and the last phase of every file",
+			existing:  `{"runId":"old-run"}` + "\n" + `{"id":"a","phase":"uploaded"}` + "\n" + `{"id":"a","phase":"db-updated"}` + "\n" + `{"id":"b","phase":"downloaded"}` + "\n",
+			resume:    true,
+			wantRunID: "old-run",
+			wantPhase: map[string]journalPhase{"a": phaseDBUpdated, "b": phaseDownloaded},
+		},
+		{
+			name:      "resume ignores blank lines and a half written last line",
+			existing:  `{"runId":"old-run"}` + "\n\n" + `{"id":"a","phase":"uploaded"}` + "\n" + `{"id":"b","pha`,
+			resume:    true,
+			wantRunID: "old-run",
+			wantPhase: map[string]journalPhase{"a": phaseUploaded},
+		},
+		{
+			name:      "resume of a journal without run id records the current one",
+			existing:  `{"id":"a","phase":"uploaded"}` + "\n",
+			resume:    true,
+			wantRunID: "new-run",
+			wantPhase: map[string]journalPhase{"a": phaseUploaded},
+		},
+		{
+			name:      "resume without a journal starts one",
+			resume:    true,
+			wantRunID: "new-run",
+			wantPhase: map[string]journalPhase{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "uploads-journal.jsonl")
+
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			j, err := openJournal(path, tt.resume, "new-run")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if j.runID != tt.wantRunID {
+				t.Errorf("run id = %q, want %q", j.runID, tt.wantRunID)
+			}
+
+			if len(j.entries) != len(tt.wantPhase) {
+				t.Errorf("got %d entries, want %d", len(j.entries), len(tt.wantPhase))
+			}
+
+			for id, phase := range tt.wantPhase {
+				if entry, _ := j.get(id); entry.Phase != phase {
+					t.Errorf("phase of %s = %q, want %q", id, entry.Phase, phase)
+				}
+			}
+
+			if err := j.record("c", phaseUploaded, "path/c"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the journal written is read back the same way by the next resumed run
+			reopened, err := openJournal(path, true, "another-run")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer reopened.Close()
+
+			if reopened.runID != tt.wantRunID {
+				t.Errorf("reopened run id = %q, want %q", reopened.runID, tt.wantRunID)
+			}
+
+			if entry, _ := reopened.get("c"); entry.Phase != phaseUploaded || entry.ObjectPath != "path/c" {
+				t.Errorf("reopened entry of c = %+v", entry)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// Log formats accepted by SetLogFormat
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Phases reported in the file events
+const (
+	eventSkip     = "skip"
+	eventDownload = "download"
+	eventUpload   = "upload"
+	eventDBUpdate = "db-update"
+	eventDelete   = "delete"
+)
+
+// fileEvent is what happened to a file during a phase of a run
+type fileEvent struct {
+	Index    int
+	Total    int
+	File     rocketchat.File
+	Phase    string
+	Bytes    int64
+	Duration time.Duration
+	Retries  int
+	Err      error
+}
+
+// newLogger returns a logger writing to out, or stderr when out is nil, in the given format
+func newLogger(format string, level *slog.LevelVar, out io.Writer) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+
+	if out == nil {
+		out = os.Stderr
+	}
+
+	switch format {
+	case "", LogFormatText:
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	default:
+		return nil, fmt.Errorf("%w: invalid log format %q, must be %s or %s", ErrInvalidConfig, format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// DebugMode sets debug mode on
+func (m *Migrate) DebugMode() {
+	m.debug = true
+
+	if m.logLevel != nil {
+		m.logLevel.Set(slog.LevelDebug)
+	}
+}
+
+// SetLogFormat switches the log output between text and json
+func (m *Migrate) SetLogFormat(format string) error {
+	if m.logLevel == nil {
+		m.logLevel = new(slog.LevelVar)
+	}
+
+	l, err := newLogger(format, m.logLevel, m.logOutput)
+	if err != nil {
+		return err
+	}
+
+	m.log = l
+	m.logFormat = format
+
+	return nil
+}
+
+// SetLogOutput sets where the logs are written to, keeping the log format
+func (m *Migrate) SetLogOutput(out io.Writer) error {
+	m.logOutput = out
+
+	return m.SetLogFormat(m.logFormat)
+}
+
+// SetLogger replaces the logger the migration events are written to
+func (m *Migrate) SetLogger(l *slog.Logger) {
+	m.log = l
+}
+
+func (m *Migrate) logger() *slog.Logger {
+	if m.log == nil {
+		return slog.Default()
+	}
+
+	return m.log
+}
+
+func (m *Migrate) debugLog(v ...interface{}) {
+	if m.debug {
+		m.logger().Debug(strings.TrimSpace(fmt.Sprintln(v...)))
+	}
+}
+
+func (m *Migrate) infoLog(v ...interface{}) {
+	m.logger().Info(strings.TrimSpace(fmt.Sprintln(v...)))
+}
+
+// logFileEvent logs a file event with the fields every file event carries
+func (m *Migrate) logFileEvent(level slog.Level, msg string, event fileEvent) {
+	source := ""
+	if m.sourceStore != nil {
+		source = m.sourceStore.StoreType()
+	}
+
+	destination := ""
+	if m.destinationStore != nil {
+		destination = m.destinationStore.StoreType()
+	}
+
+	errMsg := ""
+	if event.Err != nil {
+		errMsg = event.Err.Error()
+	}
+
+	m.logger().Log(context.Background(), level, msg,
+		slog.Int("index", event.Index),
+		slog.Int("total", event.Total),
+		slog.String("file_id", event.File.ID),
+		slog.String("file_name", event.File.Name),
+		slog.String("store", m.storeName),
+		slog.String("phase", event.Phase),
+		slog.Int64("bytes", event.Bytes),
+		slog.Int64("duration_ms", event.Duration.Milliseconds()),
+		slog.Int("retries", event.Retries),
+		slog.String("source", source),
+		slog.String("destination", destination),
+		slog.String("error", errMsg),
+	)
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
@@ -14,6 +13,7 @@ import (
 	"github.com/RocketChat/filestore-migrator/store"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type rocketChatSetting struct {
@@ -21,31 +21,48 @@ type rocketChatSetting struct {
 	Value string
 }
 
-// DebugMode sets debug mode on
-func (m *Migrate) DebugMode() {
-	m.debug = true
-}
+// readSetting returns the value of the Rocket.Chat setting, a setting that doesn't exist being a configuration error
+func readSetting(ctx context.Context, settingsCollection *mongo.Collection, id string) (string, error) {
+	var setting rocketChatSetting
 
-func (m *Migrate) debugLog(v ...interface{}) {
-	if m.debug {
-		logger(v...)
+	if err := settingsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&setting); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: setting %s not found", ErrInvalidConfig, id)
+		}
+
+		return "", fmt.Errorf("%w: reading setting %s: %w", ErrDatabaseUnreachable, id, err)
 	}
-}
 
-func logger(v ...interface{}) {
-	all := append([]interface{}{fmt.Sprintf("[%s]", time.Now().Format("01/02/2006 15:04:05"))}, v...)
-	log.Println(all...)
+	return setting.Value, nil
 }
 
-// SetFileDelay set the delay between
+// SetFileDelay set the delay between files being started. The delay is shared
+// by all workers so it acts as a global rate limit
 func (m *Migrate) SetFileDelay(duration time.Duration) {
 	m.fileDelay = duration
 }
 
+// SetResume makes the next run pick up from the journal left by a previous one
+// instead of starting over
+func (m *Migrate) SetResume(resume bool) {
+	m.resume = resume
+}
+
+// SetConcurrency sets the number of files that will be processed in parallel
+func (m *Migrate) SetConcurrency(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("%w: concurrency must be at least 1", ErrInvalidConfig)
+	}
+
+	m.concurrency = workers
+
+	return nil
+}
+
 // SetStoreName that will be operating on
 func (m *Migrate) SetStoreName(storeName string) error {
-	if storeName != "Uploads" && storeName != "Avatars" {
-		return errors.New("Invalid Store Name")
+	if _, ok := storeCollection(storeName); !ok {
+		return fmt.Errorf("%w: Invalid Store Name", ErrInvalidConfig)
 	}
 
 	m.storeName = storeName
@@ -61,163 +78,347 @@ func (m *Migrate) SetStoreName(storeName string) error {
 	return nil
 }
 
-func (m *Migrate) getFiles() ([]rocketchat.File, error) {
-	if m.storeName == "" {
-		return nil, errors.New("no store Name")
+// collectionName returns the collection holding the documents of the current store
+func (m *Migrate) collectionName() (string, error) {
+	collection, ok := storeCollection(m.storeName)
+	if !ok {
+		return "", fmt.Errorf("%w: Invalid store Name", ErrInvalidConfig)
 	}
 
-	m.debugLog("Store: ", m.storeName)
+	return collection, nil
+}
 
-	fileCollection := ""
+// fileStores are the Rocket.Chat file stores along with the collection holding their documents
+// and the prefix of their objects in object storage providers
+var fileStores = []struct {
+	Name       string
+	Collection string
+	PathPrefix string
+}{
+	{"Uploads", "rocketchat_uploads", "uploads"},
+	{"Avatars", "rocketchat_avatars", "avatars"},
+	{"UserDataFiles", "rocketchat_userDataFiles", "uploads/userData"},
+}
 
-	switch m.storeName {
-	case "Uploads":
-		fileCollection = "rocketchat_uploads"
-	case "Avatars":
-		fileCollection = "rocketchat_avatars"
-	default:
-		return nil, errors.New("Invalid store Name")
+// storePathPrefix returns the prefix of the objects of the store, below the uniqueID
+func storePathPrefix(storeName string) string {
+	for _, fileStore := range fileStores {
+		if fileStore.Name == storeName {
+			return fileStore.PathPrefix
+		}
 	}
 
-	m.fileCollectionName = fileCollection
+	return strings.ToLower(storeName)
+}
+
+// storeCollection returns the collection holding the documents of the store
+func storeCollection(storeName string) (string, bool) {
+	for _, fileStore := range fileStores {
+		if fileStore.Name == storeName {
+			return fileStore.Collection, true
+		}
+	}
+
+	return "", false
+}
+
+func (m *Migrate) getFiles(ctx context.Context) (*fileCursor, error) {
+	return m.getFilesInStore(ctx, m.sourceStore, true)
+}
+
+// getFilesInStore returns a cursor over the files whose documents reference the given storage provider,
+// only keeping those passing the filter and the file offset when filtered is set
+func (m *Migrate) getFilesInStore(ctx context.Context, target store.Provider, filtered bool) (*fileCursor, error) {
+	if m.storeName == "" {
+		return nil, fmt.Errorf("%w: no store Name", ErrInvalidConfig)
+	}
+
+	m.debugLog("Store: ", m.storeName)
 
-	session, err := connectDB(m.connectionString)
+	fileCollection, err := m.collectionName()
 	if err != nil {
 		return nil, err
 	}
 
-	m.session = session
+	m.fileCollectionName = fileCollection
+
+	// keep the same connection when running several stores
+	if m.session == nil {
+		session, err := connectDB(ctx, m.connectionString)
+		if err != nil {
+			return nil, err
+		}
+
+		m.session = session
+	}
 
-	db := session.Client().Database(m.databaseName)
+	db := m.session.Client().Database(m.databaseName)
 
 	settingsCollection := db.Collection("rocketchat_settings")
 
-	var uniqueID rocketChatSetting
-
-	if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "uniqueID"}).Decode(&uniqueID); err != nil {
+	uniqueID, err := readSetting(ctx, settingsCollection, "uniqueID")
+	if err != nil {
 		return nil, err
 	}
 
 	m.debugLog("uniqueId", uniqueID)
-	m.uniqueID = uniqueID.Value
+	m.uniqueID = uniqueID
 
 	collection := db.Collection(fileCollection)
 
-	var files []rocketchat.File
+	m.debugLog(fileCollection, target.StoreType()+":"+m.storeName)
 
-	m.debugLog(fileCollection, m.sourceStore.StoreType()+":"+m.storeName)
+	query := bson.M{"store": target.StoreType() + ":" + m.storeName}
+	if filtered {
+		query = m.fileQuery(target.StoreType())
+	}
 
-	query := bson.M{"store": m.sourceStore.StoreType() + ":" + m.storeName}
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
 
-	if !m.fileOffset.IsZero() {
-		query["uploadedAt"] = bson.M{"$gte": m.fileOffset}
+	totalBytes, err := sumFileSizes(ctx, collection, query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
 	}
 
-	if cursor, err := collection.Find(context.TODO(), query, &options.FindOptions{Sort: bson.D{{"uploadedAt", -1}}}); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("No files found")
-		}
+	documents := &batchCursor{
+		collection: collection,
+		query:      query,
+		options:    options.Find().SetSort(fileSort).SetProjection(fileProjection),
+		after:      afterFile,
+		batchSize:  m.batchSize,
+	}
 
-		return nil, err
-	} else {
-		if err = cursor.All(context.TODO(), &files); err != nil {
-			return nil, err
-		}
+	return &fileCursor{documents: documents, count: int(total), bytes: totalBytes}, nil
+}
+
+// sumFileSizes returns the sum of the sizes of the files matching the query
+func sumFileSizes(ctx context.Context, collection *mongo.Collection, query bson.M) (int64, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: query}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "size": bson.M{"$sum": "$size"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// the sum is a double as soon as one of the sizes is
+	var sums []struct {
+		Size float64 `bson:"size"`
+	}
+
+	if err := cursor.All(ctx, &sums); err != nil {
+		return 0, err
+	}
+
+	if len(sums) == 0 {
+		return 0, nil
 	}
 
-	return files, nil
+	return int64(sums[0].Size), nil
 }
 
-// MigrateStore migrates a filestore between source and destination
-func (m *Migrate) MigrateStore() error {
+// MigrateStore migrates a filestore between source and destination. The report is returned
+// along with the error when the run is aborted part way
+func (m *Migrate) MigrateStore(ctx context.Context) (*Report, error) {
 	if m.sourceStore == nil || m.destinationStore == nil {
-		return errors.New("For MigrateStore both a source and destionation store must be provided")
+		return nil, fmt.Errorf("%w: For MigrateStore both a source and destionation store must be provided", ErrInvalidConfig)
 	}
 
-	files, err := m.getFiles()
+	files, err := m.getFiles(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	m.debugLog(fmt.Sprintf("Found %v files\n", files.total()))
+
+	// the journal goes first as a resumed run takes over the run id it holds
+	if err := m.startJournal(); err != nil {
+		return nil, err
 	}
 
-	m.debugLog(fmt.Sprintf("Found %v files\n", len(files)))
+	defer m.stopJournal()
 
-	for i, file := range files {
-		index := i + 1 // for logs
+	report := m.newReport(ActionMigrate, files.total(), files.totalBytes())
+	defer report.finish()
 
-		if m.storeName == "Avatars" && file.Rid != "" {
-			// https://github.com/RocketChat/Rocket.Chat/blob/a7823c1b0901c510af5bfa994e7b3f96ee10dd91/apps/meteor/app/file-upload/server/lib/FileUpload.ts#L81-L84
-			file.IsRoomAvatar = true
-		}
+	if err := m.resetFailed(ctx, ActionMigrate); err != nil {
+		m.infoLog("Failed to reset the failed list:", err)
+	}
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Downloading %s from: %s\n", index, len(files), file.Name, m.sourceStore.StoreType()))
+	err = m.processFiles(ctx, files, func(index int, file rocketchat.File) error {
+		event := fileEvent{Index: index, Total: files.total(), File: file}
+		m.metrics.startFile(m.storeName, index, files.total())
 
 		if !file.Complete {
-			m.debugLog(fmt.Sprintf("[%v/%v] File wasn't completed uploading for %s Skipping\n", index, len(files), file.Name))
-			continue
+			event.Phase = eventSkip
+			m.logFileEvent(slog.LevelInfo, "File wasn't completed uploading, skipping", event)
+			report.addSkippedIncomplete()
+
+			return nil
 		}
 
-		downloadedPath, err := m.sourceStore.Download(m.fileCollectionName, file)
-		if err != nil {
-			if errors.Is(err, store.ErrNotFound) || m.skipErrors {
-				m.debugLog(fmt.Sprintf("[%v/%v] No corresponding file for %s Skipping\n", index, len(files), file.Name))
-				err = nil
-				continue
-			} else {
+		checkpoint, _ := m.journal.get(file.ID)
+
+		if checkpoint.Phase == phaseDBUpdated {
+			event.Phase = eventSkip
+			m.logFileEvent(slog.LevelInfo, "File already migrated in a previous run, skipping", event)
+			report.addSkippedDone()
+
+			return nil
+		}
+
+		objectPath := checkpoint.ObjectPath
+
+		if checkpoint.Phase == phaseUploaded {
+			event.Phase = eventUpload
+			m.logFileEvent(slog.LevelDebug, "File already uploaded in a previous run", event)
+		} else {
+			m.normalizeFile(&file)
+
+			var err error
+			if objectPath, err = m.getObjectPath(&file); err != nil {
 				return err
 			}
-		}
 
-		if file.Rid == "" && m.storeName == "Uploads" {
-			file.Rid = "undefined"
-		}
+			event.Phase = eventUpload
+			m.logFileEvent(slog.LevelDebug, "Uploading to "+objectPath, event)
 
-		if file.UserID == "" {
-			file.UserID = "undefined"
-		}
+			start := time.Now()
 
-		objectPath := m.getObjectPath(&file)
+			bytes, err := m.transferFile(ctx, &event, file, objectPath)
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Uploading to %s to: %s\n", index, len(files), m.destinationStore.StoreType(), objectPath))
+			event.Bytes = bytes
+			event.Duration = time.Since(start)
+			event.Err = err
 
-		if err := m.destinationStore.Upload(objectPath, downloadedPath, file.Type); err != nil {
-			return err
-		}
+			if err != nil {
+				var srcErr *sourceError
+				if errors.As(err, &srcErr) && errors.Is(err, store.ErrNotFound) {
+					event.Phase = eventDownload
+					m.logFileEvent(slog.LevelWarn, "No corresponding file, skipping", event)
+					report.addSkippedNotFound()
+
+					return nil
+				}
+
+				m.recordFailed(report, file, err)
+
+				if errors.As(err, &srcErr) && m.skipErrors {
+					event.Phase = eventDownload
+					m.logFileEvent(slog.LevelWarn, "Failed to download file, skipping", event)
+
+					return nil
+				}
+
+				m.logFileEvent(slog.LevelError, "Failed to transfer file", event)
+
+				if errors.As(err, &srcErr) {
+					return fmt.Errorf("%w: %w", ErrSourceUnreachable, err)
+				}
+
+				return err
+			}
 
-		set, unset := m.fixFileForUpload(&file, objectPath)
+			m.logFileEvent(slog.LevelDebug, "Uploaded file", event)
 
-		update := bson.M{
-			"$set": set,
+			if err := m.journal.record(file.ID, phaseUploaded, objectPath); err != nil {
+				return err
+			}
 		}
 
-		if unset != "" {
-			update["$unset"] = bson.M{unset: 1}
+		// Once the file is uploaded its document is updated even when ctx is cancelled, so the file
+		// is finished rather than left uploaded but still pointing at the source
+		start := time.Now()
+		err := m.updateFile(context.WithoutCancel(ctx), &event, &file, objectPath)
+
+		event.Phase = eventDBUpdate
+		event.Duration = time.Since(start)
+		event.Err = err
+
+		if err != nil {
+			m.logFileEvent(slog.LevelError, "Failed to update file in database", event)
+			m.recordFailed(report, file, err)
+
+			return err
 		}
 
-		db := m.session.Client().Database(m.databaseName)
-		collection := db.Collection(m.fileCollectionName)
+		m.metrics.observe(m.storeName, eventDBUpdate, event.Duration)
 
-		if _, err := collection.UpdateOne(context.TODO(), bson.M{"_id": file.ID}, update); err != nil {
+		if err := m.journal.record(file.ID, phaseDBUpdated, objectPath); err != nil {
 			return err
 		}
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Completed Uploading %s\n", index, len(files), file.Name))
+		m.logFileEvent(slog.LevelDebug, "Completed migrating file", event)
+		report.addMigrated(event.Bytes)
 
-		time.Sleep(m.fileDelay)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
 
+	if m.deleteSource {
+		if err := m.DeleteSources(ctx, m.deleteSourceAfter); err != nil {
+			return report, err
+		}
 	}
 
 	m.debugLog("Finished!")
 
-	return nil
+	return report, nil
 }
 
-func (m *Migrate) getObjectPath(file *rocketchat.File) string {
+// normalizeFile fills in the fields Rocket.Chat derives when building the object path
+func (m *Migrate) normalizeFile(file *rocketchat.File) {
+	if m.storeName == "Avatars" && file.Rid != "" {
+		// https://github.com/RocketChat/Rocket.Chat/blob/a7823c1b0901c510af5bfa994e7b3f96ee10dd91/apps/meteor/app/file-upload/server/lib/FileUpload.ts#L81-L84
+		file.IsRoomAvatar = true
+	}
+
+	if file.Rid == "" && m.storeName == "Uploads" {
+		file.Rid = "undefined"
+	}
+
+	if file.UserID == "" {
+		file.UserID = "undefined"
+	}
+}
+
+// getObjectPath returns the path the file is stored at in the destination store
+func (m *Migrate) getObjectPath(file *rocketchat.File) (string, error) {
+	objectPath := m.objectStoragePath(file)
+
+	switch m.destinationStore.StoreType() {
+	case "FileSystem":
+		// FileSystem, SFTP included, just dumps them in the folder based on the ID
+		objectPath = file.ID
+	case "GridFS":
+		// GridFS stores them in the bucket named after the collection using the ID
+		objectPath = m.fileCollectionName + "/" + file.ID
+	case "Webdav":
+		// WebDAV keeps the files of every store in the upload folder using the ID
+		webdav, ok := m.destinationStore.(store.ObjectPathProvider)
+		if !ok {
+			return "", fmt.Errorf("%w: the Webdav destination doesn't provide the path of its files", ErrInvalidConfig)
+		}
+
+		objectPath = webdav.ObjectPath(file.ID)
+	}
+
+	return objectPath, nil
+}
+
+// objectStoragePath returns the path Rocket.Chat uses for the file in object storage providers
+func (m *Migrate) objectStoragePath(file *rocketchat.File) string {
 	objectPath := ""
 
 	switch m.storeName {
 	case "Uploads":
 		// https://github.com/RocketChat/Rocket.Chat/blob/a7823c1b0901c510af5bfa994e7b3f96ee10dd91/apps/meteor/app/file-upload/server/lib/FileUpload.ts#L58-L60
-		objectPath = fmt.Sprintf("%s/%s/%s/%s/%s", m.uniqueID, strings.ToLower(m.storeName), file.Rid, file.UserID, file.ID)
+		objectPath = fmt.Sprintf("%s/%s/%s/%s/%s", m.uniqueID, storePathPrefix(m.storeName), file.Rid, file.UserID, file.ID)
 	case "Avatars":
 		var pathSuffix string
 		if file.IsRoomAvatar {
@@ -227,20 +428,18 @@ func (m *Migrate) getObjectPath(file *rocketchat.File) string {
 			pathSuffix = file.UserID
 		}
 
-		objectPath = fmt.Sprintf("%s/%s/%s", m.uniqueID, strings.ToLower(m.storeName), pathSuffix)
-	}
-
-	// FileSystem just dumps them in the folder based on the ID
-	if m.destinationStore.StoreType() == "FileSystem" {
-		objectPath = file.ID
+		objectPath = fmt.Sprintf("%s/%s/%s", m.uniqueID, storePathPrefix(m.storeName), pathSuffix)
+	case "UserDataFiles":
+		// https://github.com/RocketChat/Rocket.Chat/blob/a7823c1b0901c510af5bfa994e7b3f96ee10dd91/apps/meteor/app/file-upload/server/lib/FileUpload.ts
+		objectPath = fmt.Sprintf("%s/%s/%s", m.uniqueID, storePathPrefix(m.storeName), file.UserID)
 	}
 
 	return objectPath
 }
 
-func (m *Migrate) fixFileForUpload(file *rocketchat.File, objectPath string) (rocketchat.FileSetOp, string) {
+func (m *Migrate) fixFileForUpload(file *rocketchat.File, objectPath string) (rocketchat.FileSetOp, []string) {
 	// what to unset
-	unset := ""
+	var unset []string
 
 	set := rocketchat.FileSetOp{}
 
@@ -251,7 +450,7 @@ func (m *Migrate) fixFileForUpload(file *rocketchat.File, objectPath string) (ro
 		}
 
 		// Set to empty object so won't be saved back
-		unset = "GoogleStorage"
+		unset = []string{"GoogleStorage", "AzureBlob", "Webdav"}
 
 	case "GoogleCloudStorage":
 		set.GoogleStorage = &rocketchat.GoogleStorage{
@@ -259,7 +458,24 @@ func (m *Migrate) fixFileForUpload(file *rocketchat.File, objectPath string) (ro
 		}
 
 		// Set to empty object so won't be saved back
-		unset = "AmazonS3"
+		unset = []string{"AmazonS3", "AzureBlob", "Webdav"}
+	case "AzureBlob":
+		set.AzureBlob = &rocketchat.AzureBlob{
+			Path: objectPath,
+		}
+
+		// Set to empty object so won't be saved back
+		unset = []string{"AmazonS3", "GoogleStorage", "Webdav"}
+	case "Webdav":
+		set.Webdav = &rocketchat.Webdav{
+			Path: objectPath,
+		}
+
+		// Set to empty object so won't be saved back
+		unset = []string{"AmazonS3", "GoogleStorage", "AzureBlob"}
+	case "GridFS":
+		// GridFS doesn't keep a path reference so none of the cloud subdocuments applies
+		unset = []string{"AmazonS3", "GoogleStorage", "AzureBlob", "Webdav"}
 	case "FileSystem":
 	default:
 	}
@@ -273,10 +489,52 @@ func (m *Migrate) fixFileForUpload(file *rocketchat.File, objectPath string) (ro
 	return set, unset
 }
 
+// updateFile backs up the current location of the file for the run and points its document at objectPath.
+// Transient errors updating the document are retried following the retry policy, counting the retries in the event
+func (m *Migrate) updateFile(ctx context.Context, event *fileEvent, file *rocketchat.File, objectPath string) error {
+	if err := m.backupFile(ctx, file); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	collection := m.session.Client().Database(m.databaseName).Collection(m.fileCollectionName)
+
+	update := m.buildFileUpdate(file, objectPath)
+
+	err := m.retry(ctx, event, func() error {
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": file.ID}, update)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	return nil
+}
+
+// buildFileUpdate returns the mongo update document pointing the file at its new location
+func (m *Migrate) buildFileUpdate(file *rocketchat.File, objectPath string) bson.M {
+	set, unset := m.fixFileForUpload(file, objectPath)
+
+	update := bson.M{
+		"$set": set,
+	}
+
+	if len(unset) > 0 {
+		unsetOp := bson.M{}
+		for _, field := range unset {
+			unsetOp[field] = 1
+		}
+
+		update["$unset"] = unsetOp
+	}
+
+	return update
+}
+
 // SetFileOffset sets an offset for file upload/downloads
 func (m *Migrate) SetFileOffset(offset time.Time) error {
 	if offset.IsZero() {
-		return errors.New("invalid date")
+		return fmt.Errorf("%w: invalid date", ErrInvalidConfig)
 	}
 
 	m.fileOffset = offset
@@ -284,110 +542,244 @@ func (m *Migrate) SetFileOffset(offset time.Time) error {
 	return nil
 }
 
-// DownloadAll downloads all files from a filestore
-func (m *Migrate) DownloadAll() error {
+// DownloadAll downloads all files from a filestore. The report is returned along with the
+// error when the run is aborted part way
+func (m *Migrate) DownloadAll(ctx context.Context) (*Report, error) {
 	if m.sourceStore == nil {
-		return errors.New("For DownloadAll must have a source store provided")
+		return nil, fmt.Errorf("%w: For DownloadAll must have a source store provided", ErrInvalidConfig)
 	}
 
-	files, err := m.getFiles()
+	files, err := m.getFiles(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	m.debugLog(fmt.Sprintf("Found %v files\n", len(files)))
+	m.debugLog(fmt.Sprintf("Found %v files\n", files.total()))
+
+	report := m.newReport(ActionDownload, files.total(), files.totalBytes())
+	defer report.finish()
 
-	for i, file := range files {
-		index := i + 1 // for logs
+	if err := m.resetFailed(ctx, ActionDownload); err != nil {
+		m.infoLog("Failed to reset the failed list:", err)
+	}
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Downloading %s from: %s\n", index, len(files), file.Name, m.sourceStore.StoreType()))
+	err = m.processFiles(ctx, files, func(index int, file rocketchat.File) error {
+		event := fileEvent{Index: index, Total: files.total(), File: file, Phase: eventDownload}
+		m.metrics.startFile(m.storeName, index, files.total())
 
 		if !file.Complete {
-			fmt.Printf("[%v/%v] rocketchat.File wasn't completed uploading for %s Skipping\n", index, len(files), file.Name)
-			continue
+			event.Phase = eventSkip
+			m.logFileEvent(slog.LevelInfo, "File wasn't completed uploading, skipping", event)
+			report.addSkippedIncomplete()
+
+			return nil
 		}
 
-		if _, err := m.sourceStore.Download(m.fileCollectionName, file); err != nil {
-			if err == store.ErrNotFound || m.skipErrors {
-				fmt.Printf("[%v/%v] No corresponding file for %s Skipping\n", index, len(files), file.Name)
-				err = nil
-				continue
-			} else {
-				return err
+		m.logFileEvent(slog.LevelDebug, "Downloading file", event)
+
+		start := time.Now()
+
+		var downloadedPath string
+
+		err := m.retry(ctx, &event, func() error {
+			var err error
+			downloadedPath, err = m.sourceStore.Download(ctx, m.fileCollectionName, file)
+
+			return err
+		})
+
+		event.Duration = time.Since(start)
+		event.Err = err
+
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				m.logFileEvent(slog.LevelWarn, "No corresponding file, skipping", event)
+				report.addSkippedNotFound()
+
+				return nil
+			}
+
+			m.recordFailed(report, file, err)
+
+			if m.skipErrors {
+				m.logFileEvent(slog.LevelWarn, "Failed to download file, skipping", event)
+
+				return nil
 			}
+
+			m.logFileEvent(slog.LevelError, "Failed to download file", event)
+
+			return fmt.Errorf("%w: %w", ErrSourceUnreachable, err)
 		}
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Downloaded %s from: %s\n", index, len(files), file.Name, m.sourceStore.StoreType()))
+		if info, err := os.Stat(downloadedPath); err == nil {
+			event.Bytes = info.Size()
+		}
 
-		time.Sleep(m.fileDelay)
+		m.logFileEvent(slog.LevelDebug, "Downloaded file", event)
+		m.metrics.observe(m.storeName, eventDownload, event.Duration)
+		report.addMigrated(event.Bytes)
+
+		return nil
+	})
+	if err != nil {
+		return report, err
 	}
 
 	m.debugLog("Finished!")
 
-	return nil
+	return report, nil
 }
 
-// UploadAll uploads all files from a filestore
-func (m *Migrate) UploadAll(filesRoot string) error {
+// UploadAll uploads all files from a filestore. The report is returned along with the
+// error when the run is aborted part way
+func (m *Migrate) UploadAll(ctx context.Context, filesRoot string) (*Report, error) {
 	if m.destinationStore == nil {
-		return errors.New("For UploadAll must have a destination store provided")
+		return nil, fmt.Errorf("%w: For UploadAll must have a destination store provided", ErrInvalidConfig)
 	}
 
-	files, err := m.getFiles()
+	files, err := m.getFiles(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	m.debugLog(fmt.Sprintf("Found %v files in database\n", len(files)))
+	m.debugLog(fmt.Sprintf("Found %v files in database\n", files.total()))
+
+	// the journal goes first as a resumed run takes over the run id it holds
+	if err := m.startJournal(); err != nil {
+		return nil, err
+	}
+
+	defer m.stopJournal()
+
+	report := m.newReport(ActionUpload, files.total(), files.totalBytes())
+	defer report.finish()
+
+	if err := m.resetFailed(ctx, ActionUpload); err != nil {
+		m.infoLog("Failed to reset the failed list:", err)
+	}
 
 	filesRoot = filesRoot + "/" + strings.ToLower(m.storeName)
 
-	for i, file := range files {
-		index := i + 1 // for logs
+	err = m.processFiles(ctx, files, func(index int, file rocketchat.File) error {
+		event := fileEvent{Index: index, Total: files.total(), File: file, Phase: eventUpload}
+		m.metrics.startFile(m.storeName, index, files.total())
 
 		fileLocation := filesRoot + "/" + file.ID
 
-		if _, err := os.Stat(fileLocation); os.IsNotExist(err) {
-			log.Println("Failed to locate: ", file.Name)
-			continue
-		}
+		info, err := os.Stat(fileLocation)
+		if os.IsNotExist(err) {
+			event.Phase = eventSkip
+			event.Err = err
+			m.logFileEvent(slog.LevelWarn, "Failed to locate file, skipping", event)
+			report.addSkippedNotFound()
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Uploading %s to: %s\n", index, len(files), file.Name, m.destinationStore.StoreType()))
+			return nil
+		}
 
 		if !file.Complete {
-			fmt.Printf("[%v/%v] rocketchat.File wasn't completed uploading for %s Skipping\n", index, len(files), file.Name)
-			continue
+			event.Phase = eventSkip
+			m.logFileEvent(slog.LevelInfo, "File wasn't completed uploading, skipping", event)
+			report.addSkippedIncomplete()
+
+			return nil
 		}
 
-		objectPath := m.getObjectPath(&file)
+		checkpoint, _ := m.journal.get(file.ID)
+
+		// The downloaded copy may have been cut short, it is only uploaded if it has the size of the file
+		if checkpoint.Phase != phaseUploaded && checkpoint.Phase != phaseDBUpdated && info != nil && info.Size() != int64(file.Size) {
+			err := fmt.Errorf("%w: downloaded copy has %d bytes, expected %d", store.ErrSizeMismatch, info.Size(), file.Size)
+
+			event.Phase = eventSkip
+			event.Err = err
+			m.recordFailed(report, file, err)
+
+			if m.skipErrors {
+				m.logFileEvent(slog.LevelWarn, "Downloaded copy is incomplete, skipping", event)
+				return nil
+			}
+
+			m.logFileEvent(slog.LevelError, "Downloaded copy is incomplete", event)
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Uploading to %s to: %s\n", index, len(files), m.destinationStore.StoreType(), objectPath))
-		if err := m.destinationStore.Upload(objectPath, fileLocation, file.Type); err != nil {
 			return err
 		}
 
-		set, unset := m.fixFileForUpload(&file, objectPath)
+		if checkpoint.Phase == phaseDBUpdated {
+			event.Phase = eventSkip
+			m.logFileEvent(slog.LevelInfo, "File already uploaded in a previous run, skipping", event)
+			report.addSkippedDone()
 
-		update := bson.M{
-			"$set": set,
+			return nil
 		}
 
-		if unset != "" {
-			update["$unset"] = bson.M{unset: 1}
+		objectPath := checkpoint.ObjectPath
+
+		if checkpoint.Phase != phaseUploaded {
+			if objectPath, err = m.getObjectPath(&file); err != nil {
+				return err
+			}
+
+			m.logFileEvent(slog.LevelDebug, "Uploading to "+objectPath, event)
+
+			start := time.Now()
+			err := m.retry(ctx, &event, func() error {
+				return m.destinationStore.Upload(ctx, objectPath, fileLocation, file.Type)
+			})
+
+			event.Duration = time.Since(start)
+			event.Err = err
+
+			if info != nil {
+				event.Bytes = info.Size()
+			}
+
+			if err != nil {
+				m.logFileEvent(slog.LevelError, "Failed to upload file", event)
+				m.recordFailed(report, file, err)
+
+				return fmt.Errorf("%w: %w", ErrDestinationUnreachable, err)
+			}
+
+			m.logFileEvent(slog.LevelDebug, "Uploaded file", event)
+			m.metrics.observe(m.storeName, eventUpload, event.Duration)
+
+			if err := m.journal.record(file.ID, phaseUploaded, objectPath); err != nil {
+				return err
+			}
 		}
 
-		collection := m.session.Client().Database(m.databaseName).Collection(m.fileCollectionName)
+		// Once the file is uploaded its document is updated even when ctx is cancelled, see MigrateStore
+		start := time.Now()
+		err = m.updateFile(context.WithoutCancel(ctx), &event, &file, objectPath)
+
+		event.Phase = eventDBUpdate
+		event.Duration = time.Since(start)
+		event.Err = err
+
+		if err != nil {
+			m.logFileEvent(slog.LevelError, "Failed to update file in database", event)
+			m.recordFailed(report, file, err)
 
-		if _, err := collection.UpdateOne(context.TODO(), bson.M{"_id": file.ID}, update); err != nil {
 			return err
 		}
 
-		m.debugLog(fmt.Sprintf("[%v/%v] Completed Uploading %s\n", index, len(files), file.Name))
+		m.metrics.observe(m.storeName, eventDBUpdate, event.Duration)
 
-		time.Sleep(m.fileDelay)
+		if err := m.journal.record(file.ID, phaseDBUpdated, objectPath); err != nil {
+			return err
+		}
+
+		m.logFileEvent(slog.LevelDebug, "Completed uploading file", event)
+		report.addMigrated(event.Bytes)
+
+		return nil
+	})
+	if err != nil {
+		return report, err
 	}
 
 	m.debugLog("Finished!")
 
-	return nil
+	return report, nil
 }
@@ -0,0 +1,166 @@
+package migrator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/RocketChat/filestore-migrator/store"
+)
+
+func TestGetObjectPath(t *testing.T) {
+	file := rocketchat.File{ID: "file1", Rid: "room1", UserID: "user1"}
+
+	tests := []struct {
+		name        string
+		destination store.Provider
+		want        string
+		wantErr     error
+	}{
+		{name: "object storage", destination: &store.S3Provider{}, want: "unique/uploads/room1/user1/file1"},
+		{name: "file system", destination: &store.FileSystemStorageProvider{}, want: "file1"},
+		{name: "sftp", destination: &store.SFTPProvider{}, want: "file1"},
+		{name: "gridfs", destination: &store.GridFSProvider{}, want: "rocketchat_uploads/file1"},
+		{name: "webdav", destination: &store.WebDAVProvider{UploadFolderPath: "/uploads/"}, want: "uploads/file1"},
+		{name: "webdav without object paths", destination: newMemoryStore("Webdav", nil), wantErr: ErrInvalidConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Migrate{
+				storeName:          "Uploads",
+				uniqueID:           "unique",
+				fileCollectionName: "rocketchat_uploads",
+				destinationStore:   tt.destination,
+			}
+
+			objectPath, err := m.getObjectPath(&file)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getObjectPath() = %v, want %v", err, tt.wantErr)
+			}
+
+			if objectPath != tt.want {
+				t.Fatalf("getObjectPath() = %q, want %q", objectPath, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixFileForUpload(t *testing.T) {
+	file := rocketchat.File{ID: "file1", Name: "photo.png"}
+
+	tests := []struct {
+		name        string
+		destination store.Provider
+		want        rocketchat.FileSetOp
+		wantUnset   []string
+	}{
+		{
+			name:        "gridfs",
+			destination: &store.GridFSProvider{},
+			want: rocketchat.FileSetOp{
+				Url:   "https://chat.example.com/ufs/GridFS:Uploads/file1/photo.png",
+				Path:  "/ufs/GridFS:Uploads/file1/photo.png",
+				Store: "GridFS:Uploads",
+			},
+			wantUnset: []string{"AmazonS3", "GoogleStorage", "AzureBlob", "Webdav"},
+		},
+		{
+			name:        "amazon s3",
+			destination: &store.S3Provider{},
+			want: rocketchat.FileSetOp{
+				AmazonS3: &rocketchat.AmazonS3{Path: "unique/uploads/room1/user1/file1"},
+				Url:      "https://chat.example.com/ufs/AmazonS3:Uploads/file1/photo.png",
+				Path:     "/ufs/AmazonS3:Uploads/file1/photo.png",
+				Store:    "AmazonS3:Uploads",
+			},
+			wantUnset: []string{"GoogleStorage", "AzureBlob", "Webdav"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Migrate{siteUrl: "https://chat.example.com", storeName: "Uploads", destinationStore: tt.destination}
+
+			set, unset := m.fixFileForUpload(&file, "unique/uploads/room1/user1/file1")
+
+			if !reflect.DeepEqual(set, tt.want) {
+				t.Errorf("set = %+v, want %+v", set, tt.want)
+			}
+
+			if !reflect.DeepEqual(unset, tt.wantUnset) {
+				t.Errorf("unset = %v, want %v", unset, tt.wantUnset)
+			}
+		})
+	}
+}
+
+func TestSetStoreName(t *testing.T) {
+	tests := []struct {
+		storeName      string
+		wantCollection string
+		wantTempDir    string
+		wantErr        error
+	}{
+		{storeName: "Uploads", wantCollection: "rocketchat_uploads", wantTempDir: "/tmp/migrator/uploads"},
+		{storeName: "Avatars", wantCollection: "rocketchat_avatars", wantTempDir: "/tmp/migrator/avatars"},
+		{storeName: "UserDataFiles", wantCollection: "rocketchat_userDataFiles", wantTempDir: "/tmp/migrator/userdatafiles"},
+		{storeName: "Emojis", wantErr: ErrInvalidConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.storeName, func(t *testing.T) {
+			source := newMemoryStore("AmazonS3", nil)
+			destination := newMemoryStore("FileSystem", nil)
+
+			m := &Migrate{tempFileLocation: "/tmp/migrator", sourceStore: source, destinationStore: destination}
+
+			err := m.SetStoreName(tt.storeName)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetStoreName() = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			collection, err := m.collectionName()
+			if err != nil || collection != tt.wantCollection {
+				t.Errorf("collectionName() = %q, %v, want %q", collection, err, tt.wantCollection)
+			}
+
+			if source.tempDir != tt.wantTempDir || destination.tempDir != tt.wantTempDir {
+				t.Errorf("temp directories = %q and %q, want %q", source.tempDir, destination.tempDir, tt.wantTempDir)
+			}
+		})
+	}
+}
+
+func TestObjectStoragePath(t *testing.T) {
+	file := rocketchat.File{ID: "file1", Rid: "room1", UserID: "user1"}
+
+	tests := []struct {
+		storeName    string
+		isRoomAvatar bool
+		want         string
+	}{
+		{storeName: "Uploads", want: "abc123/uploads/room1/user1/file1"},
+		{storeName: "Avatars", want: "abc123/avatars/user1"},
+		{storeName: "Avatars", isRoomAvatar: true, want: "abc123/avatars/room-room1"},
+		{storeName: "UserDataFiles", want: "abc123/uploads/userData/user1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			m := &Migrate{storeName: tt.storeName, uniqueID: "abc123"}
+
+			file := file
+			file.IsRoomAvatar = tt.isRoomAvatar
+
+			if got := m.objectStoragePath(&file); got != tt.want {
+				t.Errorf("objectStoragePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
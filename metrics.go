@@ -0,0 +1,157 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons the files are skipped for in the metrics
+const (
+	skipIncomplete = "incomplete"
+	skipNotFound   = "not-found"
+	skipDone       = "done"
+)
+
+// phaseTransfer is the phase of the files streamed from the source to the destination, where
+// the download and the upload overlap
+const phaseTransfer = "transfer"
+
+// Metrics holds the Prometheus collectors updated while migrating, downloading and uploading.
+// A nil Metrics records nothing
+type Metrics struct {
+	migrated   *prometheus.CounterVec
+	skipped    *prometheus.CounterVec
+	failed     *prometheus.CounterVec
+	bytes      *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	queueDepth *prometheus.GaugeVec
+	fileIndex  *prometheus.GaugeVec
+}
+
+// NewMetrics creates the collectors and registers them with registerer
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	metrics := &Metrics{
+		migrated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "filestore_migrator_files_migrated_total",
+			Help: "Files migrated, or downloaded for the download action",
+		}, []string{"store"}),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "filestore_migrator_files_skipped_total",
+			Help: "Files skipped, by reason (incomplete, not-found, done)",
+		}, []string{"store", "reason"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "filestore_migrator_files_failed_total",
+			Help: "Files failed, by the phase they failed in (download, upload, db-update, size-mismatch, interrupted)",
+		}, []string{"store", "reason"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "filestore_migrator_bytes_transferred_total",
+			Help: "Bytes of the files migrated",
+		}, []string{"store"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "filestore_migrator_phase_duration_seconds",
+			Help:    "Time taken by each file to go through a phase (download, upload, transfer, db-update)",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"store", "phase"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "filestore_migrator_queue_depth",
+			Help: "Files of the run not started yet",
+		}, []string{"store"}),
+		fileIndex: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "filestore_migrator_current_file_index",
+			Help: "Index of the last file started by the run",
+		}, []string{"store"}),
+	}
+
+	collectors := []prometheus.Collector{
+		metrics.migrated,
+		metrics.skipped,
+		metrics.failed,
+		metrics.bytes,
+		metrics.duration,
+		metrics.queueDepth,
+		metrics.fileIndex,
+	}
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// SetMetrics sets the collectors updated by the runs
+func (m *Migrate) SetMetrics(metrics *Metrics) {
+	m.metrics = metrics
+}
+
+func (mt *Metrics) addMigrated(storeName string, bytes int64) {
+	if mt == nil {
+		return
+	}
+
+	mt.migrated.WithLabelValues(storeName).Inc()
+	mt.bytes.WithLabelValues(storeName).Add(float64(bytes))
+}
+
+func (mt *Metrics) addSkipped(storeName string, reason string) {
+	if mt == nil {
+		return
+	}
+
+	mt.skipped.WithLabelValues(storeName, reason).Inc()
+}
+
+func (mt *Metrics) addFailed(storeName string, reason string) {
+	if mt == nil {
+		return
+	}
+
+	mt.failed.WithLabelValues(storeName, reason).Inc()
+}
+
+// observe records the time a file took to go through a phase
+func (mt *Metrics) observe(storeName string, phase string, duration time.Duration) {
+	if mt == nil {
+		return
+	}
+
+	mt.duration.WithLabelValues(storeName, phase).Observe(duration.Seconds())
+}
+
+// startFile records the progress of the run as a file is started
+func (mt *Metrics) startFile(storeName string, index int, total int) {
+	if mt == nil {
+		return
+	}
+
+	mt.fileIndex.WithLabelValues(storeName).Set(float64(index))
+	mt.queueDepth.WithLabelValues(storeName).Set(float64(max(total-index, 0)))
+}
+
+// failureReason returns the phase a file failed in during an action, as told by its error
+func failureReason(action string, err error) string {
+	var srcErr *sourceError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "interrupted"
+	case errors.Is(err, store.ErrSizeMismatch):
+		return "size-mismatch"
+	case errors.Is(err, ErrDatabaseUnreachable):
+		return eventDBUpdate
+	case errors.As(err, &srcErr), errors.Is(err, ErrSourceUnreachable):
+		return eventDownload
+	case errors.Is(err, ErrDestinationUnreachable):
+		return eventUpload
+	case action == ActionDownload:
+		return eventDownload
+	default:
+		return eventUpload
+	}
+}
@@ -3,14 +3,18 @@ package migrator
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/RocketChat/filestore-migrator/config"
 	"github.com/RocketChat/filestore-migrator/store"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -31,6 +35,23 @@ type Migrate struct {
 	uniqueID           string
 	tempFileLocation   string
 	fileDelay          time.Duration
+	concurrency        int
+	batchSize          int
+	resume             bool
+	journal            *journal
+	retryPolicy        RetryPolicy
+	metrics            *Metrics
+	filter             Filter
+	fileIDs            []string
+	failedMu           sync.Mutex
+	runID              string
+	deleteSource       bool
+	deleteSourceAfter  time.Duration
+	log                *slog.Logger
+	logLevel           *slog.LevelVar
+	logFormat          string
+	logOutput          io.Writer
+	progressHook       func(report *Report)
 	debug              bool
 }
 
@@ -39,14 +60,14 @@ type settingValue struct {
 }
 
 // New takes the config and returns an initialized Migrate ready to begin migrations
-func New(config *config.Config, skipErrors bool) (*Migrate, error) {
+func New(ctx context.Context, config *config.Config, skipErrors bool) (*Migrate, error) {
 
 	if config.Database.ConnectionString == "" {
-		return nil, errors.New("Missing connectionString for Rocket.Chat's Mongo")
+		return nil, fmt.Errorf("%w: Missing connectionString for Rocket.Chat's Mongo", ErrInvalidConfig)
 	}
 
 	if config.Database.Database == "" {
-		return nil, errors.New("Missing db for Rocket.Chat's DB")
+		return nil, fmt.Errorf("%w: Missing db for Rocket.Chat's DB", ErrInvalidConfig)
 	}
 
 	if config.TempFileLocation == "" {
@@ -55,50 +76,99 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 
 	config.TempFileLocation = strings.TrimSuffix(config.TempFileLocation, "/")
 
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+
+	if config.BatchSize < 1 {
+		config.BatchSize = defaultBatchSize
+	}
+
 	fileDelay := time.Millisecond * 10
 
 	if config.FileDelay != "" {
 		delay, err := time.ParseDuration(config.FileDelay)
 		if err != nil {
-			log.Println("invalid fileDelay value")
-			return nil, err
+			return nil, fmt.Errorf("%w: invalid fileDelay value: %w", ErrInvalidConfig, err)
 		}
 
 		fileDelay = delay
 	}
 
-	s, err := connectDB(config.Database.ConnectionString)
+	var deleteSourceAfter time.Duration
+
+	if config.DeleteSourceAfter != "" {
+		after, err := time.ParseDuration(config.DeleteSourceAfter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid deleteSourceAfter value: %w", ErrInvalidConfig, err)
+		}
+
+		deleteSourceAfter = after
+	}
+
+	retryPolicy, err := parseRetryConfig(config.Retry)
 	if err != nil {
 		return nil, err
 	}
 
-	value := &settingValue{}
-	err = s.Client().Database(config.Database.Database).Collection("rocketchat_settings").FindOne(context.Background(), bson.M{"_id": "Site_Url"}).Decode(value)
+	filter, err := parseFilterConfig(config.Filter)
 	if err != nil {
 		return nil, err
 	}
 
-	migrate := &Migrate{
-		siteUrl:          strings.TrimSuffix(value.Value, "/"),
-		skipErrors:       skipErrors,
-		databaseName:     config.Database.Database,
-		connectionString: config.Database.ConnectionString,
-		tempFileLocation: config.TempFileLocation,
-		fileDelay:        fileDelay,
-		debug:            config.DebugMode,
+	s, err := connectDB(ctx, config.Database.ConnectionString)
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err := os.Stat(config.TempFileLocation + "/uploads"); os.IsNotExist(err) {
-		if err := os.MkdirAll(config.TempFileLocation+"/uploads", 0777); err != nil {
-			migrate.debugLog(err)
-			return nil, errors.New("Temp Directory doesn't exist and unable to create it")
+	value := &settingValue{}
+	err = s.Client().Database(config.Database.Database).Collection("rocketchat_settings").FindOne(ctx, bson.M{"_id": "Site_Url"}).Decode(value)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: Site_Url setting not found in database %s", ErrInvalidConfig, config.Database.Database)
 		}
+
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	logLevel := new(slog.LevelVar)
+	if config.DebugMode {
+		logLevel.Set(slog.LevelDebug)
 	}
 
-	if _, err := os.Stat(config.TempFileLocation + "/avatars"); os.IsNotExist(err) {
-		if err := os.MkdirAll(config.TempFileLocation+"/avatars", 0777); err != nil {
-			migrate.debugLog(err)
-			return nil, errors.New("Temp Directory doesn't exist and unable to create it")
+	l, err := newLogger(config.LogFormat, logLevel, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	migrate := &Migrate{
+		siteUrl:           strings.TrimSuffix(value.Value, "/"),
+		runID:             primitive.NewObjectID().Hex(),
+		skipErrors:        skipErrors,
+		databaseName:      config.Database.Database,
+		connectionString:  config.Database.ConnectionString,
+		tempFileLocation:  config.TempFileLocation,
+		fileDelay:         fileDelay,
+		concurrency:       config.Concurrency,
+		batchSize:         config.BatchSize,
+		retryPolicy:       retryPolicy,
+		filter:            filter,
+		deleteSource:      config.DeleteSource,
+		deleteSourceAfter: deleteSourceAfter,
+		debug:             config.DebugMode,
+		log:               l,
+		logLevel:          logLevel,
+		logFormat:         config.LogFormat,
+	}
+
+	for _, fileStore := range fileStores {
+		storeTempLocation := config.TempFileLocation + "/" + strings.ToLower(fileStore.Name)
+
+		if _, err := os.Stat(storeTempLocation); os.IsNotExist(err) {
+			if err := os.MkdirAll(storeTempLocation, 0777); err != nil {
+				migrate.debugLog(err)
+				return nil, fmt.Errorf("%w: Temp Directory doesn't exist and unable to create it", ErrInvalidConfig)
+			}
 		}
 	}
 
@@ -106,7 +176,7 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 
 		switch config.Source.Type {
 		case "GridFS":
-			session, err := connectDB(config.Database.ConnectionString)
+			session, err := connectDB(ctx, config.Database.ConnectionString)
 			if err != nil {
 				return nil, err
 			}
@@ -122,7 +192,7 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 
 		case "GoogleStorage":
 			if (config.Source.GoogleStorage.Bucket == "" || config.Source.GoogleStorage.JSONKey == "") && !config.Source.ReferenceOnly {
-				return nil, errors.New("Make sure you include all of the required options for GoogleStorage")
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for GoogleStorage", ErrInvalidConfig)
 			}
 
 			sourceStore := &store.GoogleStorageProvider{
@@ -134,7 +204,7 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 			migrate.sourceStore = sourceStore
 		case "AmazonS3":
 			if (config.Source.AmazonS3.AccessID == "" || config.Source.AmazonS3.AccessKey == "" || config.Source.AmazonS3.Bucket == "") && !config.Source.ReferenceOnly {
-				return nil, errors.New("Make sure you include all of the required options for AmazonS3")
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for AmazonS3", ErrInvalidConfig)
 			}
 
 			sourceStore := &store.S3Provider{
@@ -147,17 +217,65 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 				TempFileLocation: config.TempFileLocation,
 			}
 
+			migrate.sourceStore = sourceStore
+		case "AzureBlob":
+			if (config.Source.AzureBlob.Account == "" || (config.Source.AzureBlob.AccountKey == "" && config.Source.AzureBlob.SASToken == "") || config.Source.AzureBlob.Container == "") && !config.Source.ReferenceOnly {
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for AzureBlob", ErrInvalidConfig)
+			}
+
+			sourceStore := &store.AzureBlobProvider{
+				Account:          config.Source.AzureBlob.Account,
+				AccountKey:       config.Source.AzureBlob.AccountKey,
+				SASToken:         config.Source.AzureBlob.SASToken,
+				Container:        config.Source.AzureBlob.Container,
+				Endpoint:         config.Source.AzureBlob.Endpoint,
+				TempFileLocation: config.TempFileLocation,
+			}
+
+			migrate.sourceStore = sourceStore
+		case "Webdav":
+			if config.Source.Webdav.ServerURL == "" && !config.Source.ReferenceOnly {
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for Webdav", ErrInvalidConfig)
+			}
+
+			sourceStore := &store.WebDAVProvider{
+				ServerURL:        config.Source.Webdav.ServerURL,
+				Username:         config.Source.Webdav.Username,
+				Password:         config.Source.Webdav.Password,
+				UploadFolderPath: config.Source.Webdav.UploadFolderPath,
+				TempFileLocation: config.TempFileLocation,
+			}
+
+			migrate.sourceStore = sourceStore
+		case "SFTP":
+			if (config.Source.SFTP.Host == "" || config.Source.SFTP.User == "" || config.Source.SFTP.Location == "") && !config.Source.ReferenceOnly {
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for SFTP", ErrInvalidConfig)
+			}
+
+			sourceStore := &store.SFTPProvider{
+				Host:                  config.Source.SFTP.Host,
+				Port:                  config.Source.SFTP.Port,
+				User:                  config.Source.SFTP.User,
+				Password:              config.Source.SFTP.Password,
+				KeyFile:               config.Source.SFTP.KeyFile,
+				KeyPassphrase:         config.Source.SFTP.KeyPassphrase,
+				KnownHostsFile:        config.Source.SFTP.KnownHostsFile,
+				InsecureIgnoreHostKey: config.Source.SFTP.InsecureIgnoreHostKey,
+				Location:              config.Source.SFTP.Location,
+				TempFileLocation:      config.TempFileLocation,
+			}
+
 			migrate.sourceStore = sourceStore
 		case "FileSystem":
 			if config.Source.FileSystem.Location == "" && !config.Source.ReferenceOnly {
-				return nil, errors.New("Make sure you include all of the required options for FileSystem")
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for FileSystem", ErrInvalidConfig)
 			}
 
 			config.Source.FileSystem.Location = strings.TrimSuffix(config.Source.FileSystem.Location, "/")
 
 			if !config.Source.ReferenceOnly {
 				if _, err := os.Stat(config.Source.FileSystem.Location); os.IsNotExist(err) {
-					return nil, errors.New("Filesystem source location does not exist or is unaccessible")
+					return nil, fmt.Errorf("%w: Filesystem source location does not exist or is unaccessible", ErrInvalidConfig)
 				}
 			}
 
@@ -168,7 +286,7 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 
 			migrate.sourceStore = sourceStore
 		default:
-			return nil, errors.New("Invalid Source Type")
+			return nil, fmt.Errorf("%w: Invalid Source Type", ErrInvalidConfig)
 		}
 
 		migrate.debugLog("Source store type set to: ", config.Source.Type)
@@ -177,9 +295,23 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 	if config.Destination.Type != "" {
 
 		switch config.Destination.Type {
+		case "GridFS":
+			session, err := connectDB(ctx, config.Database.ConnectionString)
+			if err != nil {
+				return nil, err
+			}
+
+			destinationStore := &store.GridFSProvider{
+				Database: config.Database.Database,
+				Session:  session,
+				Buckets:  make(map[string]*gridfs.Bucket),
+			}
+
+			migrate.destinationStore = destinationStore
+
 		case "AmazonS3":
 			if config.Destination.AmazonS3.AccessID == "" || config.Destination.AmazonS3.AccessKey == "" || config.Destination.AmazonS3.Bucket == "" {
-				return nil, errors.New("Make sure you include all of the required options for AmazonS3")
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for AmazonS3", ErrInvalidConfig)
 			}
 
 			destinationStore := &store.S3Provider{
@@ -195,7 +327,7 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 
 		case "GoogleStorage":
 			if config.Destination.GoogleStorage.Bucket == "" || config.Destination.GoogleStorage.JSONKey == "" {
-				return nil, errors.New("Make sure you include all of the required options for AmazonS3")
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for AmazonS3", ErrInvalidConfig)
 			}
 
 			destinationStore := &store.GoogleStorageProvider{
@@ -203,16 +335,61 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 				Bucket:  config.Destination.GoogleStorage.Bucket,
 			}
 
+			migrate.destinationStore = destinationStore
+		case "AzureBlob":
+			if config.Destination.AzureBlob.Account == "" || (config.Destination.AzureBlob.AccountKey == "" && config.Destination.AzureBlob.SASToken == "") || config.Destination.AzureBlob.Container == "" {
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for AzureBlob", ErrInvalidConfig)
+			}
+
+			destinationStore := &store.AzureBlobProvider{
+				Account:    config.Destination.AzureBlob.Account,
+				AccountKey: config.Destination.AzureBlob.AccountKey,
+				SASToken:   config.Destination.AzureBlob.SASToken,
+				Container:  config.Destination.AzureBlob.Container,
+				Endpoint:   config.Destination.AzureBlob.Endpoint,
+			}
+
+			migrate.destinationStore = destinationStore
+		case "Webdav":
+			if config.Destination.Webdav.ServerURL == "" {
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for Webdav", ErrInvalidConfig)
+			}
+
+			destinationStore := &store.WebDAVProvider{
+				ServerURL:        config.Destination.Webdav.ServerURL,
+				Username:         config.Destination.Webdav.Username,
+				Password:         config.Destination.Webdav.Password,
+				UploadFolderPath: config.Destination.Webdav.UploadFolderPath,
+			}
+
+			migrate.destinationStore = destinationStore
+		case "SFTP":
+			if config.Destination.SFTP.Host == "" || config.Destination.SFTP.User == "" || config.Destination.SFTP.Location == "" {
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for SFTP", ErrInvalidConfig)
+			}
+
+			destinationStore := &store.SFTPProvider{
+				Host:                  config.Destination.SFTP.Host,
+				Port:                  config.Destination.SFTP.Port,
+				User:                  config.Destination.SFTP.User,
+				Password:              config.Destination.SFTP.Password,
+				KeyFile:               config.Destination.SFTP.KeyFile,
+				KeyPassphrase:         config.Destination.SFTP.KeyPassphrase,
+				KnownHostsFile:        config.Destination.SFTP.KnownHostsFile,
+				InsecureIgnoreHostKey: config.Destination.SFTP.InsecureIgnoreHostKey,
+				Location:              config.Destination.SFTP.Location,
+			}
+
 			migrate.destinationStore = destinationStore
 		case "FileSystem":
 			if config.Destination.FileSystem.Location == "" {
-				return nil, errors.New("Make sure you include all of the required options for FileSystem")
+				return nil, fmt.Errorf("%w: Make sure you include all of the required options for FileSystem", ErrInvalidConfig)
 			}
 
 			if _, err := os.Stat(config.Destination.FileSystem.Location); os.IsNotExist(err) {
 				if err := os.MkdirAll(config.Destination.FileSystem.Location, 0777); err != nil {
 					migrate.debugLog(err)
-					return nil, errors.New("filesystem directory doesn't exist and unable to create it")
+					return nil, fmt.Errorf("%w: filesystem directory doesn't exist and unable to create it", ErrInvalidConfig)
 				}
 			}
 
@@ -222,7 +399,7 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 
 			migrate.destinationStore = destinationStore
 		default:
-			return nil, errors.New("Invalid Destination Type")
+			return nil, fmt.Errorf("%w: Invalid Destination Type", ErrInvalidConfig)
 		}
 
 		migrate.debugLog("Destination store type set to: ", config.Destination.Type)
@@ -230,22 +407,40 @@ func New(config *config.Config, skipErrors bool) (*Migrate, error) {
 	}
 
 	if migrate.sourceStore == nil && migrate.destinationStore == nil {
-		return nil, errors.New("At least a source or destination store must be provided")
+		return nil, fmt.Errorf("%w: At least a source or destination store must be provided", ErrInvalidConfig)
+	}
+
+	if err := checkStoreTypes(migrate.sourceStore, migrate.destinationStore); err != nil {
+		return nil, err
 	}
 
 	return migrate, nil
 }
 
+// checkStoreTypes refuses a source and destination recording their files under the same store, as the
+// migrated files could no longer be told apart from the ones left to migrate
+func checkStoreTypes(source store.Provider, destination store.Provider) error {
+	if source == nil || destination == nil {
+		return nil
+	}
+
+	if source.StoreType() == destination.StoreType() {
+		return fmt.Errorf("%w: source and destination both record their files in the %s store", ErrInvalidConfig, source.StoreType())
+	}
+
+	return nil
+}
+
 var ErrNoJsonKey = errors.New("no-json-key")
 
 // GetRocketChatStore uses database to build source Store from settings
-func GetRocketChatStore(dbConfig config.DatabaseConfig) (*config.MigrateTarget, error) {
-	session, err := connectDB(dbConfig.ConnectionString)
+func GetRocketChatStore(ctx context.Context, dbConfig config.DatabaseConfig) (*config.MigrateTarget, error) {
+	session, err := connectDB(ctx, dbConfig.ConnectionString)
 	if err != nil {
 		return nil, err
 	}
 
-	defer session.EndSession(context.TODO())
+	defer session.EndSession(context.Background())
 
 	client := session.Client()
 
@@ -253,59 +448,53 @@ func GetRocketChatStore(dbConfig config.DatabaseConfig) (*config.MigrateTarget,
 
 	settingsCollection := db.Collection("rocketchat_settings")
 
-	var fileUploadStorageType rocketChatSetting
-
-	if err = settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_Storage_Type"}).Decode(&fileUploadStorageType); err != nil {
+	fileUploadStorageType, err := readSetting(ctx, settingsCollection, "FileUpload_Storage_Type")
+	if err != nil {
 		return nil, err
 	}
 
 	sourceStore := &config.MigrateTarget{}
 
-	switch fileUploadStorageType.Value {
+	switch fileUploadStorageType {
 	case "GridFS":
 		sourceStore.Type = "GridFS"
 		return sourceStore, nil
 	case "AmazonS3":
 		sourceStore.Type = "AmazonS3"
-		var awsAccessID rocketChatSetting
-
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_S3_AWSAccessKeyId"}).Decode(&awsAccessID); err != nil {
+		awsAccessID, err := readSetting(ctx, settingsCollection, "FileUpload_S3_AWSAccessKeyId")
+		if err != nil {
 			return nil, err
 		}
 
-		var awsSecret rocketChatSetting
-
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_S3_AWSSecretAccessKey"}).Decode(&awsSecret); err != nil {
+		awsSecret, err := readSetting(ctx, settingsCollection, "FileUpload_S3_AWSSecretAccessKey")
+		if err != nil {
 			return nil, err
 		}
 
-		var bucket rocketChatSetting
-
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_S3_Bucket"}).Decode(&bucket); err != nil {
+		bucket, err := readSetting(ctx, settingsCollection, "FileUpload_S3_Bucket")
+		if err != nil {
 			return nil, err
 		}
 
-		var region rocketChatSetting
-
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_S3_Region"}).Decode(&region); err != nil {
+		region, err := readSetting(ctx, settingsCollection, "FileUpload_S3_Region")
+		if err != nil {
 			return nil, err
 		}
 
-		var s3url rocketChatSetting
-
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_S3_BucketURL"}).Decode(&s3url); err != nil {
+		s3url, err := readSetting(ctx, settingsCollection, "FileUpload_S3_BucketURL")
+		if err != nil {
 			return nil, err
 		}
 
-		if s3url.Value == "" {
-			s3url.Value = "s3.amazonaws.com"
+		if s3url == "" {
+			s3url = "s3.amazonaws.com"
 		}
 
-		sourceStore.AmazonS3.Endpoint = s3url.Value
-		sourceStore.AmazonS3.Bucket = bucket.Value
-		sourceStore.AmazonS3.AccessID = awsAccessID.Value
-		sourceStore.AmazonS3.AccessKey = awsSecret.Value
-		sourceStore.AmazonS3.Region = region.Value
+		sourceStore.AmazonS3.Endpoint = s3url
+		sourceStore.AmazonS3.Bucket = bucket
+		sourceStore.AmazonS3.AccessID = awsAccessID
+		sourceStore.AmazonS3.AccessKey = awsSecret
+		sourceStore.AmazonS3.Region = region
 		sourceStore.AmazonS3.UseSSL = true
 
 		return sourceStore, nil
@@ -313,13 +502,12 @@ func GetRocketChatStore(dbConfig config.DatabaseConfig) (*config.MigrateTarget,
 	case "GoogleCloudStorage":
 		sourceStore.Type = "GoogleStorage"
 
-		var settingValue rocketChatSetting
-
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_GoogleStorage_Bucket"}).Decode(&settingValue); err != nil {
+		settingValue, err := readSetting(ctx, settingsCollection, "FileUpload_GoogleStorage_Bucket")
+		if err != nil {
 			return nil, err
 		}
 
-		sourceStore.GoogleStorage.Bucket = settingValue.Value
+		sourceStore.GoogleStorage.Bucket = settingValue
 
 		//this is a weird one
 		// currently a workaround, that asks for a json key file to be downloaded first
@@ -328,28 +516,64 @@ func GetRocketChatStore(dbConfig config.DatabaseConfig) (*config.MigrateTarget,
 
 	case "FileSystem":
 		sourceStore.Type = "FileSystem"
-		var filesystemLocation rocketChatSetting
+		filesystemLocation, err := readSetting(ctx, settingsCollection, "FileUpload_FileSystemPath")
+		if err != nil {
+			return nil, err
+		}
 
-		if err := settingsCollection.FindOne(context.TODO(), bson.M{"_id": "FileUpload_FileSystemPath"}).Decode(&filesystemLocation); err != nil {
+		sourceStore.FileSystem.Location = filesystemLocation
+		return sourceStore, nil
+
+	case "Webdav":
+		sourceStore.Type = "Webdav"
+
+		serverURL, err := readSetting(ctx, settingsCollection, "FileUpload_Webdav_Server_URL")
+		if err != nil {
 			return nil, err
 		}
 
-		sourceStore.FileSystem.Location = filesystemLocation.Value
+		username, err := readSetting(ctx, settingsCollection, "FileUpload_Webdav_Username")
+		if err != nil {
+			return nil, err
+		}
+
+		password, err := readSetting(ctx, settingsCollection, "FileUpload_Webdav_Password")
+		if err != nil {
+			return nil, err
+		}
+
+		uploadFolderPath, err := readSetting(ctx, settingsCollection, "FileUpload_Webdav_Upload_Folder_Path")
+		if err != nil {
+			return nil, err
+		}
+
+		sourceStore.Webdav.ServerURL = serverURL
+		sourceStore.Webdav.Username = username
+		sourceStore.Webdav.Password = password
+		sourceStore.Webdav.UploadFolderPath = uploadFolderPath
+
 		return sourceStore, nil
 
 	default:
-		return nil, errors.New("unable to detect supported fileupload storage type.  (Unable to detect google storage currently)")
+		return nil, fmt.Errorf("%w: unable to detect supported fileupload storage type.  (Unable to detect google storage currently)", ErrInvalidConfig)
 	}
 }
 
-func connectDB(connectionstring string) (mongo.Session, error) {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(connectionstring))
+func connectDB(ctx context.Context, connectionstring string) (mongo.Session, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionstring))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 	}
+
+	// the driver connects lazily, make sure the database is there before going any further
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
 	sess, err := client.StartSession(&options.SessionOptions{})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
 	}
 
 	return sess, nil
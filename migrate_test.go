@@ -0,0 +1,37 @@
+package migrator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/store"
+)
+
+func TestCheckStoreTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      store.Provider
+		destination store.Provider
+		wantErr     bool
+	}{
+		{name: "different stores", source: &store.S3Provider{}, destination: &store.GoogleStorageProvider{}},
+		{name: "source only", source: &store.SFTPProvider{}},
+		{name: "destination only", destination: &store.FileSystemStorageProvider{}},
+		{name: "sftp and file system", source: &store.FileSystemStorageProvider{}, destination: &store.SFTPProvider{}, wantErr: true},
+		{name: "same store", source: &store.S3Provider{}, destination: &store.S3Provider{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStoreTypes(tt.source, tt.destination)
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("checkStoreTypes() = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("checkStoreTypes() = %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/RocketChat/filestore-migrator/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrphanReport lists the differences between the objects in a store and the documents referencing them
+type OrphanReport struct {
+	Store     string `json:"store"`
+	StoreType string `json:"storeType"`
+	Prefix    string `json:"prefix,omitempty"`
+
+	Objects   int `json:"objects"`
+	Documents int `json:"documents"`
+
+	// OrphanObjects are the keys of objects no document references
+	OrphanObjects []string `json:"orphanObjects"`
+	// MissingObjects are the ids of documents whose object doesn't exist
+	MissingObjects []string `json:"missingObjects"`
+
+	Deleted int `json:"deleted"`
+}
+
+// Orphans compares the objects of the current store with the documents referencing them.
+// The source store is inspected, or the destination one when there is no source.
+// When deleteOrphans is set the objects no document references are removed
+func (m *Migrate) Orphans(ctx context.Context, deleteOrphans bool) (*OrphanReport, error) {
+	target := m.sourceStore
+	if target == nil {
+		target = m.destinationStore
+	}
+
+	files, err := m.getFilesInStore(ctx, target, false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OrphanReport{
+		Store:          m.storeName,
+		StoreType:      target.StoreType(),
+		OrphanObjects:  []string{},
+		MissingObjects: []string{},
+	}
+
+	if target.StoreType() == "AmazonS3" || target.StoreType() == "GoogleCloudStorage" || target.StoreType() == "AzureBlob" {
+		report.Prefix = m.uniqueID + "/" + storePathPrefix(m.storeName) + "/"
+	}
+
+	referenced := make(map[string]bool)
+
+	// only the key and id of every document are kept so the memory used stays low
+	type storedObject struct {
+		key string
+		id  string
+	}
+
+	var documents []storedObject
+
+	for {
+		file, ok, err := files.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		key := m.storedObjectKey(target, &file)
+		referenced[key] = true
+		documents = append(documents, storedObject{key: key, id: file.ID})
+	}
+
+	report.Documents = len(documents)
+
+	// Stores keyed by file id can be shared by every Rocket.Chat store, so an object
+	// is only an orphan when no document of any of them references it
+	if report.Prefix == "" {
+		if err := m.addReferencedIDs(ctx, target, referenced); err != nil {
+			return nil, err
+		}
+	}
+
+	listed := make(map[string]bool)
+
+	nestedPrefixes := m.nestedStorePrefixes(report.Prefix)
+
+	err = target.List(ctx, m.fileCollectionName, report.Prefix, func(key string, size int64) error {
+		for _, nested := range nestedPrefixes {
+			if strings.HasPrefix(key, nested) {
+				return nil
+			}
+		}
+
+		listed[key] = true
+		report.Objects++
+
+		if !referenced[key] {
+			report.OrphanObjects = append(report.OrphanObjects, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, document := range documents {
+		if !listed[document.key] {
+			report.MissingObjects = append(report.MissingObjects, document.id)
+		}
+	}
+
+	m.debugLog(fmt.Sprintf("Found %v orphan objects and %v documents without object\n", len(report.OrphanObjects), len(report.MissingObjects)))
+
+	if !deleteOrphans {
+		return report, nil
+	}
+
+	for i, key := range report.OrphanObjects {
+		m.debugLog(fmt.Sprintf("[%v/%v] Deleting orphan %s from: %s\n", i+1, len(report.OrphanObjects), key, target.StoreType()))
+
+		if err := target.Delete(ctx, m.fileCollectionName, objectKeyFile(target, key), true); err != nil {
+			if m.skipErrors {
+				m.debugLog(fmt.Sprintf("[%v/%v] Failed to delete %s Skipping: %s\n", i+1, len(report.OrphanObjects), key, err))
+				continue
+			}
+
+			return report, err
+		}
+
+		report.Deleted++
+	}
+
+	return report, nil
+}
+
+// addReferencedIDs adds the ids of the documents of the other stores kept in the given store to referenced
+func (m *Migrate) addReferencedIDs(ctx context.Context, target store.Provider, referenced map[string]bool) error {
+	db := m.session.Client().Database(m.databaseName)
+
+	for _, fileStore := range fileStores {
+		if fileStore.Name == m.storeName {
+			continue
+		}
+
+		query := bson.M{"store": target.StoreType() + ":" + fileStore.Name}
+
+		cursor, err := db.Collection(fileStore.Collection).Find(ctx, query, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+
+		var ids []struct {
+			ID string `bson:"_id"`
+		}
+
+		if err := cursor.All(ctx, &ids); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			referenced[id.ID] = true
+		}
+	}
+
+	return nil
+}
+
+// storedObjectKey returns the key of the object holding the file in the given store
+func (m *Migrate) storedObjectKey(target store.Provider, file *rocketchat.File) string {
+	switch target.StoreType() {
+	case "AmazonS3":
+		if file.AmazonS3.Path != "" {
+			return file.AmazonS3.Path
+		}
+	case "GoogleCloudStorage":
+		if file.GoogleStorage.Path != "" {
+			return file.GoogleStorage.Path
+		}
+	case "AzureBlob":
+		if file.AzureBlob.Path != "" {
+			return file.AzureBlob.Path
+		}
+	case "Webdav":
+		// the files are listed by name, which is the id unless the document says otherwise
+		if file.Webdav.Path != "" {
+			return path.Base(file.Webdav.Path)
+		}
+
+		return file.ID
+	default:
+		return file.ID
+	}
+
+	// fallback to the path Rocket.Chat would have used
+	normalized := *file
+	m.normalizeFile(&normalized)
+
+	return m.objectStoragePath(&normalized)
+}
+
+// nestedStorePrefixes returns the prefixes of the stores nested below the given one, like the user data exports
+// below the uploads, so their objects are left to their own store
+func (m *Migrate) nestedStorePrefixes(prefix string) []string {
+	var nestedPrefixes []string
+
+	if prefix == "" {
+		return nestedPrefixes
+	}
+
+	for _, fileStore := range fileStores {
+		nested := m.uniqueID + "/" + fileStore.PathPrefix + "/"
+		if nested != prefix && strings.HasPrefix(nested, prefix) {
+			nestedPrefixes = append(nestedPrefixes, nested)
+		}
+	}
+
+	return nestedPrefixes
+}
+
+// objectKeyFile returns a file referencing the object with the given key in the store
+func objectKeyFile(target store.Provider, key string) rocketchat.File {
+	switch target.StoreType() {
+	case "AmazonS3":
+		return rocketchat.File{AmazonS3: rocketchat.AmazonS3{Path: key}}
+	case "GoogleCloudStorage":
+		return rocketchat.File{GoogleStorage: rocketchat.GoogleStorage{Path: key}}
+	case "AzureBlob":
+		return rocketchat.File{AzureBlob: rocketchat.AzureBlob{Path: key}}
+	default:
+		return rocketchat.File{ID: key}
+	}
+}
+
+// Summary returns a short human readable description of the report
+func (r *OrphanReport) Summary() string {
+	return fmt.Sprintf("%s: %d objects listed on %s, %d documents, %d orphan objects, %d documents without object, %d deleted",
+		r.Store, r.Objects, r.StoreType, r.Documents, len(r.OrphanObjects), len(r.MissingObjects), r.Deleted)
+}
+
+// WriteJSON writes the report as indented JSON to the given path
+func (r *OrphanReport) WriteJSON(path string) error {
+	if r == nil {
+		return errors.New("empty report")
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
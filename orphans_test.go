@@ -0,0 +1,123 @@
+package migrator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+func TestStoredObjectKey(t *testing.T) {
+	m := &Migrate{storeName: "Uploads", uniqueID: "abc123"}
+
+	tests := []struct {
+		name      string
+		storeType string
+		file      rocketchat.File
+		want      string
+	}{
+		{
+			name:      "s3 path from the document",
+			storeType: "AmazonS3",
+			file:      rocketchat.File{ID: "file1", AmazonS3: rocketchat.AmazonS3{Path: "custom/file1"}},
+			want:      "custom/file1",
+		},
+		{
+			name:      "s3 path rocket.chat would have used",
+			storeType: "AmazonS3",
+			file:      rocketchat.File{ID: "file1", Rid: "room1", UserID: "user1"},
+			want:      "abc123/uploads/room1/user1/file1",
+		},
+		{
+			name:      "google storage path without room or user",
+			storeType: "GoogleCloudStorage",
+			file:      rocketchat.File{ID: "file1"},
+			want:      "abc123/uploads/undefined/undefined/file1",
+		},
+		{
+			name:      "azure path from the document",
+			storeType: "AzureBlob",
+			file:      rocketchat.File{ID: "file1", AzureBlob: rocketchat.AzureBlob{Path: "custom/file1"}},
+			want:      "custom/file1",
+		},
+		{
+			name:      "webdav name from the document",
+			storeType: "Webdav",
+			file:      rocketchat.File{ID: "file1", Webdav: rocketchat.Webdav{Path: "/uploads/renamed"}},
+			want:      "renamed",
+		},
+		{
+			name:      "webdav name defaults to the id",
+			storeType: "Webdav",
+			file:      rocketchat.File{ID: "file1"},
+			want:      "file1",
+		},
+		{
+			name:      "file system",
+			storeType: "FileSystem",
+			file:      rocketchat.File{ID: "file1", AmazonS3: rocketchat.AmazonS3{Path: "custom/file1"}},
+			want:      "file1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.file
+
+			if got := m.storedObjectKey(newMemoryStore(tt.storeType, nil), &file); got != tt.want {
+				t.Errorf("storedObjectKey() = %q, want %q", got, tt.want)
+			}
+
+			// the document itself is left untouched
+			if file.Rid != tt.file.Rid || file.UserID != tt.file.UserID {
+				t.Errorf("storedObjectKey() changed the file to %+v", file)
+			}
+		})
+	}
+}
+
+func TestObjectKeyFile(t *testing.T) {
+	m := &Migrate{storeName: "Uploads", uniqueID: "abc123"}
+
+	// the file built from a listed key points back at the same object
+	for _, storeType := range []string{"AmazonS3", "GoogleCloudStorage", "AzureBlob", "FileSystem", "GridFS"} {
+		t.Run(storeType, func(t *testing.T) {
+			target := newMemoryStore(storeType, nil)
+
+			key := "abc123/uploads/room1/user1/file1"
+			if storeType == "FileSystem" || storeType == "GridFS" {
+				key = "file1"
+			}
+
+			file := objectKeyFile(target, key)
+
+			if got := m.storedObjectKey(target, &file); got != key {
+				t.Errorf("storedObjectKey(objectKeyFile(%q)) = %q", key, got)
+			}
+		})
+	}
+}
+
+func TestNestedStorePrefixes(t *testing.T) {
+	m := &Migrate{uniqueID: "abc123"}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		// the user data exports are kept below the uploads
+		{prefix: "abc123/uploads/", want: []string{"abc123/uploads/userData/"}},
+		{prefix: "abc123/uploads/userData/"},
+		{prefix: "abc123/avatars/"},
+		// stores keyed by file id aren't listed by prefix
+		{prefix: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := m.nestedStorePrefixes(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nestedStorePrefixes(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/RocketChat/filestore-migrator/store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Plan describes what a run would do without transferring or updating anything
+type Plan struct {
+	Store       string `json:"store"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	TotalFiles int   `json:"totalFiles"`
+	TotalBytes int64 `json:"totalBytes"`
+
+	// Incomplete holds the ids of files that weren't completely uploaded to Rocket.Chat and will be skipped
+	Incomplete []string `json:"incomplete"`
+	// Missing holds the ids of files without a corresponding object in the source
+	Missing []string `json:"missing"`
+	// Failed holds the files whose source object couldn't be checked when errors are skipped
+	Failed []ReportFailure `json:"failed"`
+
+	Files []PlannedFile `json:"files"`
+}
+
+// PlannedFile is a file that would be transferred and the update its document would receive
+type PlannedFile struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Size       int             `json:"size"`
+	ObjectPath string          `json:"objectPath,omitempty"`
+	Update     json.RawMessage `json:"update,omitempty"`
+}
+
+// Plan builds the plan for the current store. Each source object is checked to exist without being downloaded.
+// When filesRoot is provided the files are looked up there instead, the same way UploadAll does
+func (m *Migrate) Plan(ctx context.Context, filesRoot string) (*Plan, error) {
+	if m.sourceStore == nil {
+		return nil, fmt.Errorf("%w: For Plan must have a source store provided", ErrInvalidConfig)
+	}
+
+	files, err := m.getFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.debugLog(fmt.Sprintf("Found %v files\n", files.total()))
+
+	plan := &Plan{
+		Store:      m.storeName,
+		Source:     m.sourceStore.StoreType(),
+		TotalFiles: files.total(),
+		Incomplete: []string{},
+		Missing:    []string{},
+		Failed:     []ReportFailure{},
+		Files:      []PlannedFile{},
+	}
+
+	if m.destinationStore != nil {
+		plan.Destination = m.destinationStore.StoreType()
+	}
+
+	if filesRoot != "" {
+		filesRoot = filesRoot + "/" + strings.ToLower(m.storeName)
+	}
+
+	var mu sync.Mutex
+
+	err = m.processFiles(ctx, files, func(index int, file rocketchat.File) error {
+		if !file.Complete {
+			m.debugLog(fmt.Sprintf("[%v/%v] File wasn't completed uploading for %s Skipping\n", index, files.total(), file.Name))
+
+			mu.Lock()
+			plan.Incomplete = append(plan.Incomplete, file.ID)
+			mu.Unlock()
+
+			return nil
+		}
+
+		var err error
+
+		if filesRoot != "" {
+			_, err = os.Stat(filesRoot + "/" + file.ID)
+			if os.IsNotExist(err) {
+				err = store.ErrNotFound
+			}
+		} else {
+			_, err = m.sourceStore.Stat(ctx, m.fileCollectionName, file)
+		}
+
+		if errors.Is(err, store.ErrNotFound) {
+			m.debugLog(fmt.Sprintf("[%v/%v] No corresponding file for %s Skipping\n", index, files.total(), file.Name))
+
+			mu.Lock()
+			plan.Missing = append(plan.Missing, file.ID)
+			mu.Unlock()
+
+			return nil
+		}
+
+		if err != nil {
+			if m.skipErrors {
+				m.debugLog(fmt.Sprintf("[%v/%v] Unable to check %s Skipping: %s\n", index, files.total(), file.Name, err))
+
+				mu.Lock()
+				plan.Failed = append(plan.Failed, ReportFailure{ID: file.ID, Name: file.Name, Error: err.Error()})
+				mu.Unlock()
+
+				return nil
+			}
+
+			return fmt.Errorf("%w: %w", ErrSourceUnreachable, err)
+		}
+
+		planned := PlannedFile{
+			ID:   file.ID,
+			Name: file.Name,
+			Size: file.Size,
+		}
+
+		if m.destinationStore != nil {
+			// like UploadAll, the upload plan builds the object path from the document as it is
+			if filesRoot == "" {
+				m.normalizeFile(&file)
+			}
+
+			if planned.ObjectPath, err = m.getObjectPath(&file); err != nil {
+				return err
+			}
+
+			update, err := bson.MarshalExtJSON(m.buildFileUpdate(&file, planned.ObjectPath), false, false)
+			if err != nil {
+				return err
+			}
+
+			planned.Update = update
+		}
+
+		mu.Lock()
+		plan.Files = append(plan.Files, planned)
+		plan.TotalBytes += int64(file.Size)
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// Summary returns a short human readable description of the plan
+func (p *Plan) Summary() string {
+	return fmt.Sprintf("%s: %d files found, %d to transfer (%d bytes), %d incomplete, %d missing from source, %d failed",
+		p.Store, p.TotalFiles, len(p.Files), p.TotalBytes, len(p.Incomplete), len(p.Missing), len(p.Failed))
+}
+
+// WriteJSON writes the plan as indented JSON to the given path
+func (p *Plan) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,103 @@
+package migrator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// processFiles runs fn for every file yielded by files using the configured number of workers.
+// fileDelay is shared by all the workers so files are never started faster than
+// one per fileDelay, regardless of the concurrency.
+// The first error returned by fn or files, or the cancellation of ctx, stops any new file from
+// being started and is returned once the files already in progress are done
+func (m *Migrate) processFiles(ctx context.Context, files fileIterator, fn func(index int, file rocketchat.File) error) error {
+	workers := m.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var throttle <-chan time.Time
+
+	if m.fileDelay > 0 {
+		ticker := time.NewTicker(m.fileDelay)
+		defer ticker.Stop()
+
+		throttle = ticker.C
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	type job struct {
+		index int
+		file  rocketchat.File
+	}
+
+	jobs := make(chan job)
+	abort := make(chan struct{})
+
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(abort)
+		})
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				if err := fn(j.index, j.file); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 1; ; i++ {
+		file, ok, err := files.next(ctx)
+		if err != nil {
+			fail(err)
+			break
+		}
+
+		if !ok {
+			break
+		}
+
+		if throttle != nil && i > 1 {
+			select {
+			case <-throttle:
+			case <-abort:
+				break feed
+			case <-ctx.Done():
+				fail(ctx.Err())
+				break feed
+			}
+		}
+
+		select {
+		case jobs <- job{index: i, file: file}:
+		case <-abort:
+			break feed
+		case <-ctx.Done():
+			fail(ctx.Err())
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
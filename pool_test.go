@@ -0,0 +1,159 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// fileList iterates over files already in memory
+type fileList struct {
+	files []rocketchat.File
+}
+
+func newFileList(count int) *fileList {
+	list := &fileList{}
+
+	for i := 1; i <= count; i++ {
+		list.files = append(list.files, rocketchat.File{ID: fmt.Sprintf("file%d", i)})
+	}
+
+	return list
+}
+
+func (l *fileList) total() int {
+	return len(l.files)
+}
+
+func (l *fileList) next(ctx context.Context) (rocketchat.File, bool, error) {
+	if len(l.files) == 0 {
+		return rocketchat.File{}, false, nil
+	}
+
+	file := l.files[0]
+	l.files = l.files[1:]
+
+	return file, true, nil
+}
+
+func TestProcessFiles(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			m := &Migrate{concurrency: workers}
+
+			var (
+				mu      sync.Mutex
+				indexes = make(map[int]string)
+				running int32
+				peak    int32
+			)
+
+			err := m.processFiles(context.Background(), newFileList(20), func(index int, file rocketchat.File) error {
+				current := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+
+				for {
+					seen := atomic.LoadInt32(&peak)
+					if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+						break
+					}
+				}
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if _, ok := indexes[index]; ok {
+					t.Errorf("index %d given twice", index)
+				}
+
+				indexes[index] = file.ID
+
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("processFiles() = %v", err)
+			}
+
+			for i := 1; i <= 20; i++ {
+				if indexes[i] != fmt.Sprintf("file%d", i) {
+					t.Errorf("index %d processed %q, want file%d", i, indexes[i], i)
+				}
+			}
+
+			if peak > int32(workers) {
+				t.Errorf("%d files processed at once, want at most %d", peak, workers)
+			}
+		})
+	}
+}
+
+func TestProcessFilesAbort(t *testing.T) {
+	m := &Migrate{concurrency: 2}
+	failure := errors.New("upload failed")
+
+	var processed int32
+
+	err := m.processFiles(context.Background(), newFileList(100), func(index int, file rocketchat.File) error {
+		atomic.AddInt32(&processed, 1)
+
+		if index == 3 {
+			return failure
+		}
+
+		return nil
+	})
+
+	if !errors.Is(err, failure) {
+		t.Fatalf("processFiles() = %v, want %v", err, failure)
+	}
+
+	// the workers busy when the error happens may still finish their file
+	if processed > 5 {
+		t.Fatalf("%d files processed after the failure, want the run aborted", processed)
+	}
+}
+
+func TestProcessFilesCancel(t *testing.T) {
+	m := &Migrate{concurrency: 2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := m.processFiles(ctx, newFileList(100), func(index int, file rocketchat.File) error {
+		if index == 3 {
+			cancel()
+		}
+
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("processFiles() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestProcessFilesDelay(t *testing.T) {
+	// the delay is shared by every worker, so it spaces the start of every file
+	m := &Migrate{concurrency: 4, fileDelay: 20 * time.Millisecond}
+
+	start := time.Now()
+
+	err := m.processFiles(context.Background(), newFileList(5), func(index int, file rocketchat.File) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("processFiles() = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("5 files started in %s, want at least 80ms with a 20ms delay", elapsed)
+	}
+}
@@ -0,0 +1,262 @@
+package migrator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// Actions a Report can be produced for
+const (
+	ActionMigrate  = "migrate"
+	ActionDownload = "download"
+	ActionUpload   = "upload"
+)
+
+// Report is the outcome of a MigrateStore, DownloadAll or UploadAll run
+type Report struct {
+	Action      string    `json:"action"`
+	Store       string    `json:"store"`
+	RunID       string    `json:"runId,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+
+	TotalFiles int `json:"totalFiles"`
+	// TotalBytes is the sum of the sizes recorded in the database for the files of the run
+	TotalBytes int64 `json:"totalBytes"`
+	// Migrated counts the files transferred by the run, or downloaded for the download action
+	Migrated          int `json:"migrated"`
+	SkippedIncomplete int `json:"skippedIncomplete"`
+	SkippedNotFound   int `json:"skippedNotFound"`
+	// SkippedDone counts the files a resumed run found already migrated by a previous one
+	SkippedDone int `json:"skippedDone"`
+
+	Failed []ReportFailure `json:"failed"`
+
+	Bytes          int64   `json:"bytes"`
+	WallTime       float64 `json:"wallTimeSeconds"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+
+	mu      sync.Mutex
+	metrics *Metrics
+}
+
+// ReportFailure describes a file the run couldn't process
+type ReportFailure struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// Progress is a snapshot of a run still going on
+type Progress struct {
+	Action     string
+	Store      string
+	TotalFiles int
+	// DoneFiles counts the files migrated, skipped or failed so far
+	DoneFiles  int
+	Failed     int
+	TotalBytes int64
+	Bytes      int64
+	Elapsed    time.Duration
+	Finished   bool
+}
+
+// newReport starts the report of an action on the current store, handing it to the progress hook
+func (m *Migrate) newReport(action string, total int, totalBytes int64) *Report {
+	report := &Report{
+		Action:     action,
+		Store:      m.storeName,
+		StartedAt:  time.Now(),
+		TotalFiles: total,
+		TotalBytes: totalBytes,
+		Failed:     []ReportFailure{},
+		metrics:    m.metrics,
+	}
+
+	if action != ActionDownload {
+		report.RunID = m.runID
+	}
+
+	if m.sourceStore != nil && action != ActionUpload {
+		report.Source = m.sourceStore.StoreType()
+	}
+
+	if m.destinationStore != nil && action != ActionDownload {
+		report.Destination = m.destinationStore.StoreType()
+	}
+
+	if m.progressHook != nil {
+		m.progressHook(report)
+	}
+
+	return report
+}
+
+// SetProgressHook sets a function called with the report of every migrate, download or upload
+// run as it starts, so the run can be followed through the Progress of the report
+func (m *Migrate) SetProgressHook(hook func(report *Report)) {
+	m.progressHook = hook
+}
+
+// Progress returns a snapshot of the report, it is safe to call while the run goes on
+func (r *Report) Progress() Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress := Progress{
+		Action:     r.Action,
+		Store:      r.Store,
+		TotalFiles: r.TotalFiles,
+		DoneFiles:  r.Migrated + r.SkippedIncomplete + r.SkippedNotFound + r.SkippedDone + len(r.Failed),
+		Failed:     len(r.Failed),
+		TotalBytes: r.TotalBytes,
+		Bytes:      r.Bytes,
+		Elapsed:    time.Since(r.StartedAt),
+		Finished:   !r.FinishedAt.IsZero(),
+	}
+
+	if progress.Finished {
+		progress.Elapsed = r.FinishedAt.Sub(r.StartedAt)
+	}
+
+	return progress
+}
+
+func (r *Report) addMigrated(bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Migrated++
+	r.Bytes += bytes
+
+	r.metrics.addMigrated(r.Store, bytes)
+}
+
+func (r *Report) addSkippedIncomplete() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.SkippedIncomplete++
+
+	r.metrics.addSkipped(r.Store, skipIncomplete)
+}
+
+func (r *Report) addSkippedNotFound() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.SkippedNotFound++
+
+	r.metrics.addSkipped(r.Store, skipNotFound)
+}
+
+func (r *Report) addSkippedDone() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.SkippedDone++
+
+	r.metrics.addSkipped(r.Store, skipDone)
+}
+
+func (r *Report) addFailed(file rocketchat.File, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Failed = append(r.Failed, ReportFailure{ID: file.ID, Name: file.Name, Error: err.Error()})
+
+	r.metrics.addFailed(r.Store, failureReason(r.Action, err))
+}
+
+// finish records the wall time and throughput of the run
+func (r *Report) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now()
+
+	wallTime := r.FinishedAt.Sub(r.StartedAt)
+	r.WallTime = wallTime.Seconds()
+
+	if wallTime > 0 {
+		r.BytesPerSecond = float64(r.Bytes) / wallTime.Seconds()
+	}
+}
+
+// Summary returns a short human readable description of the report
+func (r *Report) Summary() string {
+	return fmt.Sprintf("%s %s: %d files, %d migrated, %d incomplete, %d not found, %d already done, %d failed, %d bytes in %s (%.0f bytes/s)",
+		r.Action, r.Store, r.TotalFiles, r.Migrated, r.SkippedIncomplete, r.SkippedNotFound, r.SkippedDone, len(r.Failed),
+		r.Bytes, time.Duration(r.WallTime*float64(time.Second)).Round(time.Millisecond), r.BytesPerSecond)
+}
+
+// Write writes the report to the given path, as CSV when it ends in .csv and as JSON otherwise
+func (r *Report) Write(path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return r.WriteCSV(path)
+	}
+
+	return r.WriteJSON(path)
+}
+
+// WriteJSON writes the report as indented JSON to the given path
+func (r *Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// WriteCSV writes the report to the given path as a CSV with a header and a single row.
+// The failures are joined in the last column as "id: error" separated by semicolons
+func (r *Report) WriteCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	failures := make([]string, 0, len(r.Failed))
+	for _, failure := range r.Failed {
+		failures = append(failures, failure.ID+": "+failure.Error)
+	}
+
+	w := csv.NewWriter(f)
+
+	w.Write([]string{
+		"action", "store", "runId", "source", "destination", "startedAt", "finishedAt",
+		"totalFiles", "totalBytes", "migrated", "skippedIncomplete", "skippedNotFound", "skippedDone", "failed",
+		"bytes", "wallTimeSeconds", "bytesPerSecond", "failures",
+	})
+	w.Write([]string{
+		r.Action, r.Store, r.RunID, r.Source, r.Destination,
+		r.StartedAt.Format(time.RFC3339), r.FinishedAt.Format(time.RFC3339),
+		strconv.Itoa(r.TotalFiles), strconv.FormatInt(r.TotalBytes, 10), strconv.Itoa(r.Migrated), strconv.Itoa(r.SkippedIncomplete),
+		strconv.Itoa(r.SkippedNotFound), strconv.Itoa(r.SkippedDone), strconv.Itoa(len(r.Failed)),
+		strconv.FormatInt(r.Bytes, 10),
+		strconv.FormatFloat(r.WallTime, 'f', 3, 64), strconv.FormatFloat(r.BytesPerSecond, 'f', 0, 64),
+		strings.Join(failures, "; "),
+	})
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
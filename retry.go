@@ -0,0 +1,153 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/config"
+	"github.com/RocketChat/filestore-migrator/store"
+)
+
+// RetryPolicy controls how transient errors from the stores and the database are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of times an operation is attempted, 1 disables retries
+	MaxAttempts int
+	// BaseBackoff is the wait before the first retry, doubled on every following one
+	BaseBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between 0 and 1, by which every wait is randomly shortened or lengthened
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used unless the configuration or SetRetryPolicy say otherwise
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: time.Second,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+}
+
+// validate checks the values of the policy make sense
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("%w: retry max attempts must be at least 1", ErrInvalidConfig)
+	}
+
+	if p.BaseBackoff < 0 || p.MaxBackoff < p.BaseBackoff {
+		return fmt.Errorf("%w: retry backoff must be positive and no greater than the max backoff", ErrInvalidConfig)
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("%w: retry jitter must be between 0 and 1", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// backoff returns the wait before the given retry, starting at 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.BaseBackoff
+	for i := 1; i < retry && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if p.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(wait))
+	}
+
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	return wait
+}
+
+// parseRetryConfig returns the retry policy described by the configuration, using the
+// DefaultRetryPolicy values for anything left out
+func parseRetryConfig(retryConfig config.RetryConfig) (RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+
+	if retryConfig.MaxAttempts != 0 {
+		policy.MaxAttempts = retryConfig.MaxAttempts
+	}
+
+	if retryConfig.BaseBackoff != "" {
+		backoff, err := time.ParseDuration(retryConfig.BaseBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("%w: invalid retry baseBackoff value: %w", ErrInvalidConfig, err)
+		}
+
+		policy.BaseBackoff = backoff
+	}
+
+	if retryConfig.MaxBackoff != "" {
+		backoff, err := time.ParseDuration(retryConfig.MaxBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("%w: invalid retry maxBackoff value: %w", ErrInvalidConfig, err)
+		}
+
+		policy.MaxBackoff = backoff
+	}
+
+	if retryConfig.Jitter != nil {
+		policy.Jitter = *retryConfig.Jitter
+	}
+
+	return policy, policy.validate()
+}
+
+// SetRetryPolicy sets how transient errors are retried
+func (m *Migrate) SetRetryPolicy(policy RetryPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	m.retryPolicy = policy
+
+	return nil
+}
+
+// RetryPolicy returns the retry policy in use
+func (m *Migrate) RetryPolicy() RetryPolicy {
+	return m.retryPolicy
+}
+
+// isRetryable reports whether an error is worth retrying
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrInvalidConfig) {
+		return false
+	}
+
+	return store.IsRetryable(err)
+}
+
+// retry runs fn until it succeeds, fails with an error that isn't retryable or runs out of attempts,
+// waiting between attempts as the retry policy says. Every retry is logged and counted in the event
+func (m *Migrate) retry(ctx context.Context, event *fileEvent, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= m.retryPolicy.MaxAttempts || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		wait := m.retryPolicy.backoff(attempt)
+
+		event.Retries++
+		event.Err = err
+		m.logFileEvent(slog.LevelWarn, fmt.Sprintf("Transient error, retrying in %s", wait.Round(time.Millisecond)), *event)
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/RocketChat/filestore-migrator/config"
+	"github.com/RocketChat/filestore-migrator/store"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/pkg/sftp"
+	"google.golang.org/api/googleapi"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{retry: 1, want: time.Second},
+		{retry: 2, want: 2 * time.Second},
+		{retry: 3, want: 4 * time.Second},
+		{retry: 4, want: 8 * time.Second},
+		{retry: 5, want: 10 * time.Second},
+		{retry: 50, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.retry), func(t *testing.T) {
+			if wait := policy.backoff(tt.retry); wait != tt.want {
+				t.Fatalf("backoff(%d) = %s, want %s", tt.retry, wait, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.2}
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{retry: 1, min: 800 * time.Millisecond, max: 1200 * time.Millisecond},
+		{retry: 3, min: 3200 * time.Millisecond, max: 4800 * time.Millisecond},
+		// the jitter never takes the wait past the max backoff
+		{retry: 5, min: 8 * time.Second, max: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.retry), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if wait := policy.backoff(tt.retry); wait < tt.min || wait > tt.max {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.retry, wait, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRetryConfig(t *testing.T) {
+	jitter := 0.5
+	invalidJitter := 2.0
+
+	tests := []struct {
+		name    string
+		config  config.RetryConfig
+		want    RetryPolicy
+		wantErr error
+	}{
+		{
+			name:   "defaults",
+			config: config.RetryConfig{},
+			want:   DefaultRetryPolicy,
+		},
+		{
+			name:   "every field",
+			config: config.RetryConfig{MaxAttempts: 3, BaseBackoff: "500ms", MaxBackoff: "5s", Jitter: &jitter},
+			want:   RetryPolicy{MaxAttempts: 3, BaseBackoff: 500 * time.Millisecond, MaxBackoff: 5 * time.Second, Jitter: 0.5},
+		},
+		{name: "invalid duration", config: config.RetryConfig{BaseBackoff: "soon"}, wantErr: ErrInvalidConfig},
+		{name: "base above max", config: config.RetryConfig{BaseBackoff: "1m", MaxBackoff: "1s"}, wantErr: ErrInvalidConfig},
+		{name: "negative attempts", config: config.RetryConfig{MaxAttempts: -1}, wantErr: ErrInvalidConfig},
+		{name: "jitter above 1", config: config.RetryConfig{Jitter: &invalidJitter}, wantErr: ErrInvalidConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := parseRetryConfig(tt.config)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if policy != tt.want {
+				t.Fatalf("policy = %+v, want %+v", policy, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "unknown", err: errors.New("boom"), want: false},
+		{name: "not found", err: fmt.Errorf("download: %w", store.ErrNotFound), want: false},
+		{name: "size mismatch", err: fmt.Errorf("%w: copied 1 bytes, expected 2", store.ErrSizeMismatch), want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "invalid config", err: fmt.Errorf("%w: %w", ErrInvalidConfig, syscall.ECONNREFUSED), want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true},
+		{name: "unexpected eof", err: fmt.Errorf("read: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "connection reset", err: fmt.Errorf("write: %w", syscall.ECONNRESET), want: true},
+		{name: "sftp connection lost", err: fmt.Errorf("open: %w", sftp.ErrSSHFxConnectionLost), want: true},
+		{name: "google 503", err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: true},
+		{name: "google 404", err: &googleapi.Error{Code: http.StatusNotFound}, want: false},
+		{name: "minio 500", err: minio.ErrorResponse{StatusCode: http.StatusInternalServerError}, want: true},
+		{name: "minio 403", err: minio.ErrorResponse{StatusCode: http.StatusForbidden}, want: false},
+		{name: "azure 429", err: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "azure 409", err: &azcore.ResponseError{StatusCode: http.StatusConflict}, want: false},
+		{name: "http 502", err: &store.HTTPStatusError{Method: http.MethodPut, StatusCode: http.StatusBadGateway}, want: true},
+		{name: "http 401", err: &store.HTTPStatusError{Method: http.MethodPut, StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "wrapped destination error", err: fmt.Errorf("%w: %w", ErrDestinationUnreachable, &store.HTTPStatusError{StatusCode: http.StatusRequestTimeout}), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Fatalf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := fmt.Errorf("write: %w", syscall.ECONNRESET)
+	permanent := errors.New("boom")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{name: "success", errs: []error{nil}, wantAttempts: 1},
+		{name: "success after a retry", errs: []error{transient, nil}, wantAttempts: 2},
+		{name: "out of attempts", errs: []error{transient, transient, transient, nil}, wantErr: transient, wantAttempts: 3},
+		{name: "not retryable", errs: []error{permanent, nil}, wantErr: permanent, wantAttempts: 1},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Migrate{log: logger, retryPolicy: RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}}
+
+			var event fileEvent
+
+			attempts := 0
+
+			err := m.retry(context.Background(), &event, func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			if attempts != tt.wantAttempts || event.Retries != tt.wantAttempts-1 {
+				t.Fatalf("%d attempts and %d retries, want %d attempts", attempts, event.Retries, tt.wantAttempts)
+			}
+		})
+	}
+}
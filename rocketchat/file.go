@@ -18,6 +18,8 @@ type File struct {
 	Progress      float64
 	AmazonS3      AmazonS3      `bson:"AmazonS3,omitempty"`
 	GoogleStorage GoogleStorage `bson:"GoogleStorage,omitempty"`
+	AzureBlob     AzureBlob     `bson:"AzureBlob,omitempty"`
+	Webdav        Webdav        `bson:"Webdav,omitempty"`
 	UpdatedAt     time.Time     `bson:"_updatedAt"`
 	InstanceID    string        `bson:"instanceId"`
 	Identify      struct {
@@ -39,6 +41,8 @@ type File struct {
 type FileSetOp struct {
 	GoogleStorage *GoogleStorage `bson:"GoogleStorage,omitempty"`
 	AmazonS3      *AmazonS3      `bson:"AmazonS3,omitempty"`
+	AzureBlob     *AzureBlob     `bson:"AzureBlob,omitempty"`
+	Webdav        *Webdav        `bson:"Webdav,omitempty"`
 	Url           string         `bson:"url"`
 	Path          string         `bson:"path"`
 	Store         string         `bson:"store"`
@@ -53,3 +57,13 @@ type GoogleStorage struct {
 type AmazonS3 struct {
 	Path string
 }
+
+// AzureBlob is a sub property of file
+type AzureBlob struct {
+	Path string
+}
+
+// Webdav is a sub property of file
+type Webdav struct {
+	Path string
+}
@@ -0,0 +1,306 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fileBackup holds the location fields of a file document as they were before a run updated it
+type fileBackup struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	RunID  string             `bson:"runId"`
+	FileID string             `bson:"fileId"`
+	Store  string             `bson:"store"`
+	// Destination is the store the run recorded the file under
+	Destination     string                    `bson:"destination,omitempty"`
+	URL             string                    `bson:"url"`
+	Path            string                    `bson:"path"`
+	AmazonS3        *rocketchat.AmazonS3      `bson:"AmazonS3,omitempty"`
+	GoogleStorage   *rocketchat.GoogleStorage `bson:"GoogleStorage,omitempty"`
+	AzureBlob       *rocketchat.AzureBlob     `bson:"AzureBlob,omitempty"`
+	Webdav          *rocketchat.Webdav        `bson:"Webdav,omitempty"`
+	CreatedAt       time.Time                 `bson:"createdAt"`
+	RestoredAt      *time.Time                `bson:"restoredAt,omitempty"`
+	SourceDeletedAt *time.Time                `bson:"sourceDeletedAt,omitempty"`
+}
+
+// RunID returns the id the backups of this run are saved under, to be used with Rollback
+func (m *Migrate) RunID() string {
+	return m.runID
+}
+
+// backupCollectionName returns the collection holding the backups of the current store
+func (m *Migrate) backupCollectionName() (string, error) {
+	collection, err := m.collectionName()
+	if err != nil {
+		return "", err
+	}
+
+	return collection + "_migration_backup", nil
+}
+
+// backupFile saves the current location fields of the file before they are overwritten
+func (m *Migrate) backupFile(ctx context.Context, file *rocketchat.File) error {
+	backupCollection, err := m.backupCollectionName()
+	if err != nil {
+		return err
+	}
+
+	backup := fileBackup{
+		RunID:     m.runID,
+		FileID:    file.ID,
+		Store:     file.Store,
+		URL:       file.URL,
+		Path:      file.Path,
+		CreatedAt: time.Now(),
+	}
+
+	if m.destinationStore != nil {
+		backup.Destination = m.destinationStore.StoreType() + ":" + m.storeName
+	}
+
+	if file.AmazonS3.Path != "" {
+		backup.AmazonS3 = &rocketchat.AmazonS3{Path: file.AmazonS3.Path}
+	}
+
+	if file.GoogleStorage.Path != "" {
+		backup.GoogleStorage = &rocketchat.GoogleStorage{Path: file.GoogleStorage.Path}
+	}
+
+	if file.AzureBlob.Path != "" {
+		backup.AzureBlob = &rocketchat.AzureBlob{Path: file.AzureBlob.Path}
+	}
+
+	if file.Webdav.Path != "" {
+		backup.Webdav = &rocketchat.Webdav{Path: file.Webdav.Path}
+	}
+
+	collection := m.session.Client().Database(m.databaseName).Collection(backupCollection)
+
+	if _, err := collection.InsertOne(ctx, backup); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sourceFile returns the file with the location fields it had before the run updated it, so
+// the copy left in the source store can be read or removed
+func (b *fileBackup) sourceFile(file rocketchat.File) rocketchat.File {
+	file.ID = b.FileID
+	file.Store = b.Store
+	file.URL = b.URL
+	file.Path = b.Path
+	file.AmazonS3 = rocketchat.AmazonS3{}
+	file.GoogleStorage = rocketchat.GoogleStorage{}
+	file.AzureBlob = rocketchat.AzureBlob{}
+	file.Webdav = rocketchat.Webdav{}
+
+	if b.AmazonS3 != nil {
+		file.AmazonS3 = *b.AmazonS3
+	}
+
+	if b.GoogleStorage != nil {
+		file.GoogleStorage = *b.GoogleStorage
+	}
+
+	if b.AzureBlob != nil {
+		file.AzureBlob = *b.AzureBlob
+	}
+
+	if b.Webdav != nil {
+		file.Webdav = *b.Webdav
+	}
+
+	return file
+}
+
+// Rollback restores the location fields of every file of the current store updated by the given run.
+// Files whose source copy was removed since are skipped, as their document would point at nothing, and
+// so are the files not passing the filter
+func (m *Migrate) Rollback(ctx context.Context, runID string) error {
+	if runID == "" {
+		return fmt.Errorf("%w: a run id must be provided to rollback", ErrInvalidConfig)
+	}
+
+	fileCollection, err := m.collectionName()
+	if err != nil {
+		return err
+	}
+
+	backupCollection, err := m.backupCollectionName()
+	if err != nil {
+		return err
+	}
+
+	session, err := connectDB(ctx, m.connectionString)
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(context.Background())
+
+	db := session.Client().Database(m.databaseName)
+
+	backups := db.Collection(backupCollection)
+	files := db.Collection(fileCollection)
+
+	query := bson.M{"runId": runID, "restoredAt": bson.M{"$exists": false}, "sourceDeletedAt": bson.M{"$exists": false}}
+
+	skipped, err := backups.CountDocuments(ctx, bson.M{"runId": runID, "restoredAt": bson.M{"$exists": false}, "sourceDeletedAt": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	if skipped > 0 {
+		m.infoLog(fmt.Sprintf("Skipping %v files whose source copy was deleted, they are left on the destination", skipped))
+	}
+
+	total, err := backups.CountDocuments(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	if total == 0 {
+		return fmt.Errorf("%w: no backups to restore found for run %s in %s", ErrInvalidConfig, runID, backupCollection)
+	}
+
+	m.debugLog(fmt.Sprintf("Found %v files to restore\n", total))
+
+	cursor, err := backups.Find(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	defer cursor.Close(context.Background())
+
+	// the conditions of the filter, the files not passing them are left as they are
+	selected := bson.M{}
+	m.filter.apply(selected)
+
+	index := 0
+
+	// the files whose document no longer points at the store the run migrated them to, and those
+	// backed up without recording it when the destination isn't given either
+	var unmatched, unknown []string
+
+	for cursor.Next(ctx) {
+		index++
+
+		var backup fileBackup
+
+		if err := cursor.Decode(&backup); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+
+		destination := backup.Destination
+		if destination == "" && m.destinationStore != nil {
+			destination = m.destinationStore.StoreType() + ":" + m.storeName
+		}
+
+		if destination == "" {
+			m.debugLog(fmt.Sprintf("[%v/%v] Unable to tell the store %s was migrated to Skipping\n", index, total, backup.FileID))
+			unknown = append(unknown, backup.FileID)
+
+			continue
+		}
+
+		stored, update := backup.restore(destination)
+
+		filter := stored
+		if len(selected) > 0 {
+			filter = bson.M{"$and": []bson.M{stored, selected}}
+		}
+
+		m.debugLog(fmt.Sprintf("[%v/%v] Restoring %s to: %s\n", index, total, backup.FileID, backup.Store))
+
+		result, err := files.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+
+		if result.MatchedCount == 0 {
+			// a document still stored where the run put it was left out by the filter
+			if len(selected) > 0 {
+				count, err := files.CountDocuments(ctx, stored)
+				if err != nil {
+					return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+				}
+
+				if count > 0 {
+					m.debugLog(fmt.Sprintf("[%v/%v] File %s filtered out Skipping\n", index, total, backup.FileID))
+					continue
+				}
+			}
+
+			// the document was moved or removed since the run, restoring it would undo that
+			m.debugLog(fmt.Sprintf("[%v/%v] File %s is no longer stored in %s Skipping\n", index, total, backup.FileID, destination))
+			unmatched = append(unmatched, backup.FileID)
+
+			continue
+		}
+
+		if _, err := backups.UpdateOne(ctx, bson.M{"_id": backup.ID}, bson.M{"$set": bson.M{"restoredAt": time.Now()}}); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	if len(unmatched) > 0 {
+		m.infoLog(fmt.Sprintf("Skipped %v files no longer stored where the run put them: %s", len(unmatched), strings.Join(unmatched, ", ")))
+	}
+
+	if len(unknown) > 0 {
+		m.infoLog(fmt.Sprintf("Skipped %v files whose backup doesn't record where the run put them, pass the destination to restore them: %s", len(unknown), strings.Join(unknown, ", ")))
+	}
+
+	m.debugLog("Finished!")
+
+	return nil
+}
+
+// restore returns the filter matching the document of the file while it is still stored in destination,
+// and the update restoring the location fields it had before the run
+func (b *fileBackup) restore(destination string) (bson.M, bson.M) {
+	set := bson.M{
+		"store": b.Store,
+		"url":   b.URL,
+		"path":  b.Path,
+	}
+	unset := bson.M{}
+
+	if b.AmazonS3 != nil {
+		set["AmazonS3"] = b.AmazonS3
+	} else {
+		unset["AmazonS3"] = 1
+	}
+
+	if b.GoogleStorage != nil {
+		set["GoogleStorage"] = b.GoogleStorage
+	} else {
+		unset["GoogleStorage"] = 1
+	}
+
+	if b.AzureBlob != nil {
+		set["AzureBlob"] = b.AzureBlob
+	} else {
+		unset["AzureBlob"] = 1
+	}
+
+	if b.Webdav != nil {
+		set["Webdav"] = b.Webdav
+	} else {
+		unset["Webdav"] = 1
+	}
+
+	return bson.M{"_id": b.FileID, "store": destination}, bson.M{"$set": set, "$unset": unset}
+}
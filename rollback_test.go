@@ -0,0 +1,162 @@
+package migrator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFileBackupSourceFile(t *testing.T) {
+	// the document as it is once migrated to Azure, the backups hold where it was before
+	migrated := rocketchat.File{
+		ID:        "file1",
+		Name:      "photo.png",
+		Size:      42,
+		Store:     "AzureBlob:Uploads",
+		URL:       "https://chat.example.com/ufs/AzureBlob:Uploads/file1/photo.png",
+		Path:      "/ufs/AzureBlob:Uploads/file1/photo.png",
+		AzureBlob: rocketchat.AzureBlob{Path: "unique/uploads/room/user/file1"},
+	}
+
+	tests := []struct {
+		name   string
+		backup fileBackup
+		want   rocketchat.File
+	}{
+		{
+			name: "amazon s3",
+			backup: fileBackup{
+				FileID:   "file1",
+				Store:    "AmazonS3:Uploads",
+				URL:      "https://chat.example.com/ufs/AmazonS3:Uploads/file1/photo.png",
+				Path:     "/ufs/AmazonS3:Uploads/file1/photo.png",
+				AmazonS3: &rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"},
+			},
+			want: rocketchat.File{
+				ID:       "file1",
+				Name:     "photo.png",
+				Size:     42,
+				Store:    "AmazonS3:Uploads",
+				URL:      "https://chat.example.com/ufs/AmazonS3:Uploads/file1/photo.png",
+				Path:     "/ufs/AmazonS3:Uploads/file1/photo.png",
+				AmazonS3: rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"},
+			},
+		},
+		{
+			name: "google cloud storage",
+			backup: fileBackup{
+				FileID:        "file1",
+				Store:         "GoogleCloudStorage:Uploads",
+				GoogleStorage: &rocketchat.GoogleStorage{Path: "unique/uploads/room/user/file1"},
+			},
+			want: rocketchat.File{
+				ID:            "file1",
+				Name:          "photo.png",
+				Size:          42,
+				Store:         "GoogleCloudStorage:Uploads",
+				GoogleStorage: rocketchat.GoogleStorage{Path: "unique/uploads/room/user/file1"},
+			},
+		},
+		{
+			name: "webdav",
+			backup: fileBackup{
+				FileID: "file1",
+				Store:  "Webdav:Uploads",
+				Webdav: &rocketchat.Webdav{Path: "uploads/file1"},
+			},
+			want: rocketchat.File{
+				ID:     "file1",
+				Name:   "photo.png",
+				Size:   42,
+				Store:  "Webdav:Uploads",
+				Webdav: rocketchat.Webdav{Path: "uploads/file1"},
+			},
+		},
+		{
+			name:   "stores keyed by id keep no subdocument",
+			backup: fileBackup{FileID: "file1", Store: "GridFS:Uploads"},
+			want:   rocketchat.File{ID: "file1", Name: "photo.png", Size: 42, Store: "GridFS:Uploads"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backup.sourceFile(migrated); got != tt.want {
+				t.Errorf("sourceFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileBackupRestore(t *testing.T) {
+	tests := []struct {
+		name       string
+		backup     fileBackup
+		wantFilter bson.M
+		wantUpdate bson.M
+	}{
+		{
+			name: "amazon s3",
+			backup: fileBackup{
+				FileID:   "file1",
+				Store:    "AmazonS3:Uploads",
+				URL:      "https://chat.example.com/ufs/AmazonS3:Uploads/file1/photo.png",
+				Path:     "/ufs/AmazonS3:Uploads/file1/photo.png",
+				AmazonS3: &rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"},
+			},
+			wantFilter: bson.M{"_id": "file1", "store": "AzureBlob:Uploads"},
+			wantUpdate: bson.M{
+				"$set": bson.M{
+					"store":    "AmazonS3:Uploads",
+					"url":      "https://chat.example.com/ufs/AmazonS3:Uploads/file1/photo.png",
+					"path":     "/ufs/AmazonS3:Uploads/file1/photo.png",
+					"AmazonS3": &rocketchat.AmazonS3{Path: "unique/uploads/room/user/file1"},
+				},
+				"$unset": bson.M{"GoogleStorage": 1, "AzureBlob": 1, "Webdav": 1},
+			},
+		},
+		{
+			name: "webdav",
+			backup: fileBackup{
+				FileID: "file1",
+				Store:  "Webdav:Uploads",
+				Webdav: &rocketchat.Webdav{Path: "uploads/file1"},
+			},
+			wantFilter: bson.M{"_id": "file1", "store": "AzureBlob:Uploads"},
+			wantUpdate: bson.M{
+				"$set": bson.M{
+					"store":  "Webdav:Uploads",
+					"url":    "",
+					"path":   "",
+					"Webdav": &rocketchat.Webdav{Path: "uploads/file1"},
+				},
+				"$unset": bson.M{"AmazonS3": 1, "GoogleStorage": 1, "AzureBlob": 1},
+			},
+		},
+		{
+			name:       "stores keyed by id keep no subdocument",
+			backup:     fileBackup{FileID: "file1", Store: "GridFS:Uploads", Path: "/ufs/GridFS:Uploads/file1/photo.png"},
+			wantFilter: bson.M{"_id": "file1", "store": "AzureBlob:Uploads"},
+			wantUpdate: bson.M{
+				"$set":   bson.M{"store": "GridFS:Uploads", "url": "", "path": "/ufs/GridFS:Uploads/file1/photo.png"},
+				"$unset": bson.M{"AmazonS3": 1, "GoogleStorage": 1, "AzureBlob": 1, "Webdav": 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, update := tt.backup.restore("AzureBlob:Uploads")
+
+			if !reflect.DeepEqual(filter, tt.wantFilter) {
+				t.Errorf("restore() filter = %v, want %v", filter, tt.wantFilter)
+			}
+
+			if !reflect.DeepEqual(update, tt.wantUpdate) {
+				t.Errorf("restore() update = %v, want %v", update, tt.wantUpdate)
+			}
+		})
+	}
+}
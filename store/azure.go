@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// AzureBlobProvider provides methods to use Azure Blob Storage, or the Azurite emulator, as a storage provider.
+// It authenticates with the SAS token when one is set and with the account key otherwise. The endpoint
+// defaults to https://<account>.blob.core.windows.net
+type AzureBlobProvider struct {
+	Account          string
+	AccountKey       string
+	SASToken         string
+	Container        string
+	Endpoint         string
+	TempFileLocation string
+}
+
+// StoreType returns the name of the store
+func (a *AzureBlobProvider) StoreType() string {
+	return "AzureBlob"
+}
+
+// SetTempDirectory allows for the setting of the directory that will be used for temporary file store during operations
+func (a *AzureBlobProvider) SetTempDirectory(dir string) {
+	a.TempFileLocation = dir
+}
+
+func (a *AzureBlobProvider) newClient() (*azblob.Client, error) {
+	serviceURL := a.Endpoint
+	if serviceURL == "" {
+		serviceURL = "https://" + a.Account + ".blob.core.windows.net"
+	}
+
+	serviceURL = strings.TrimSuffix(serviceURL, "/") + "/"
+
+	if a.SASToken != "" {
+		return azblob.NewClientWithNoCredential(serviceURL+"?"+strings.TrimPrefix(a.SASToken, "?"), nil)
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(a.Account, a.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return azblob.NewClientWithSharedKeyCredential(serviceURL, credential, nil)
+}
+
+// isAzureNotFound reports whether err is the service telling the blob doesn't exist
+func isAzureNotFound(err error) bool {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return true
+	}
+
+	var respErr *azcore.ResponseError
+
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// Download downloads a file from the storage provider and moves it to the temporary file store
+func (a *AzureBlobProvider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	filePath := a.TempFileLocation + "/" + file.ID
+
+	if !cachedCopy(filePath, file) {
+		reader, _, err := a.Open(ctx, fileCollection, file)
+		if err != nil {
+			return "", err
+		}
+
+		defer reader.Close()
+
+		if err := writeFile(ctx, filePath, reader, int64(file.Size)); err != nil {
+			return "", err
+		}
+	}
+
+	return filePath, nil
+}
+
+// Stat returns the size of the blob referenced by the file without downloading it
+func (a *AzureBlobProvider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	client, err := a.newClient()
+	if err != nil {
+		return 0, err
+	}
+
+	properties, err := client.ServiceClient().NewContainerClient(a.Container).NewBlobClient(file.AzureBlob.Path).GetProperties(ctx, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return 0, ErrNotFound
+		}
+
+		return 0, err
+	}
+
+	if properties.ContentLength == nil {
+		return 0, nil
+	}
+
+	return *properties.ContentLength, nil
+}
+
+// Open returns a reader streaming the blob referenced by the file
+func (a *AzureBlobProvider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	client, err := a.newClient()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := client.DownloadStream(ctx, a.Container, file.AzureBlob.Path, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return nil, 0, ErrNotFound
+		}
+
+		return nil, 0, err
+	}
+
+	size := int64(-1)
+	if resp.ContentLength != nil {
+		size = *resp.ContentLength
+	}
+
+	return resp.Body, size, nil
+}
+
+// Put uploads the contents read from r to the object path, unless size is negative it has to match
+func (a *AzureBlobProvider) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	client, err := a.newClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UploadStream(ctx, a.Container, objectPath, &sizedReader{r: r, size: size}, &azblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	if err != nil {
+		return fmt.Errorf("problem uploading file to container: %w", err)
+	}
+
+	return nil
+}
+
+// Upload uploads a file from given path to the storage provider
+func (a *AzureBlobProvider) Upload(ctx context.Context, objectPath string, filePath string, contentType string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("problem opening file to upload: %w", err)
+	}
+
+	defer file.Close()
+
+	client, err := a.newClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UploadFile(ctx, a.Container, objectPath, file, &azblob.UploadFileOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	if err != nil {
+		return fmt.Errorf("problem uploading file to container: %w", err)
+	}
+
+	return nil
+}
+
+// List calls fn for every blob in the container under the prefix
+func (a *AzureBlobProvider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	client, err := a.newClient()
+	if err != nil {
+		return err
+	}
+
+	pager := client.NewListBlobsFlatPager(a.Container, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+
+			var size int64
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				size = *item.Properties.ContentLength
+			}
+
+			if err := fn(*item.Name, size); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the blob referenced by file.AzureBlob.Path
+func (a *AzureBlobProvider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
+
+	client, err := a.newClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.DeleteBlob(ctx, a.Container, file.AzureBlob.Path, nil); err != nil && !isAzureNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// azuriteAccountKey is the well known key of the devstoreaccount1 account of the Azurite emulator
+const azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+// newTestAzureProvider returns a provider using a new container of the Azurite emulator whose
+// endpoint is set in AZURITE_ENDPOINT, such as http://127.0.0.1:10000/devstoreaccount1. The test
+// is skipped when it isn't set
+func newTestAzureProvider(t *testing.T) *AzureBlobProvider {
+	t.Helper()
+
+	endpoint := os.Getenv("AZURITE_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURITE_ENDPOINT not set")
+	}
+
+	provider := &AzureBlobProvider{
+		Account:          "devstoreaccount1",
+		AccountKey:       azuriteAccountKey,
+		Container:        fmt.Sprintf("migrator-test-%d", time.Now().UnixNano()),
+		Endpoint:         endpoint,
+		TempFileLocation: t.TempDir(),
+	}
+
+	client, err := provider.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, err := client.CreateContainer(ctx, provider.Container, nil); err != nil {
+		t.Fatalf("creating the container: %v", err)
+	}
+
+	t.Cleanup(func() {
+		client.DeleteContainer(context.Background(), provider.Container, nil)
+	})
+
+	return provider
+}
+
+func TestAzureBlobProvider(t *testing.T) {
+	provider := newTestAzureProvider(t)
+	ctx := context.Background()
+
+	file := rocketchat.File{ID: "file1", Size: 5, AzureBlob: rocketchat.AzureBlob{Path: "unique/uploads/room/user/file1"}}
+
+	if err := provider.Put(ctx, file.AzureBlob.Path, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	size, err := provider.Stat(ctx, "rocketchat_uploads", file)
+	if err != nil || size != 5 {
+		t.Fatalf("Stat = %d, %v, want 5", size, err)
+	}
+
+	reader, size, err := provider.Open(ctx, "rocketchat_uploads", file)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+
+	if err != nil || string(data) != "hello" || size != 5 {
+		t.Fatalf("Open = %q (%d bytes), %v, want hello", data, size, err)
+	}
+
+	path, err := provider.Download(ctx, "rocketchat_uploads", file)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != "hello" {
+		t.Fatalf("downloaded %q, %v, want hello", data, err)
+	}
+
+	uploaded := filepath.Join(t.TempDir(), "file2")
+	if err := os.WriteFile(uploaded, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.Upload(ctx, "unique/avatars/user", uploaded, "text/plain"); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	listed := make(map[string]int64)
+
+	err = provider.List(ctx, "rocketchat_uploads", "unique/", func(key string, size int64) error {
+		listed[key] = size
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	want := map[string]int64{"unique/uploads/room/user/file1": 5, "unique/avatars/user": 11}
+	if !reflect.DeepEqual(listed, want) {
+		t.Fatalf("listed %v, want %v", listed, want)
+	}
+
+	if err := provider.Delete(ctx, "rocketchat_uploads", file, true); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := provider.Stat(ctx, "rocketchat_uploads", file); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat after Delete = %v, want %v", err, ErrNotFound)
+	}
+
+	if _, _, err := provider.Open(ctx, "rocketchat_uploads", file); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open after Delete = %v, want %v", err, ErrNotFound)
+	}
+
+	// deleting a blob that is gone isn't an error
+	if err := provider.Delete(ctx, "rocketchat_uploads", file, true); err != nil {
+		t.Fatalf("second Delete: %v", err)
+	}
+}
+
+func TestAzureBlobProviderPutSizeMismatch(t *testing.T) {
+	provider := newTestAzureProvider(t)
+	ctx := context.Background()
+
+	file := rocketchat.File{ID: "file1", AzureBlob: rocketchat.AzureBlob{Path: "unique/uploads/room/user/file1"}}
+
+	err := provider.Put(ctx, file.AzureBlob.Path, strings.NewReader("hell"), 5, "text/plain")
+	if !errors.Is(err, ErrSizeMismatch) {
+		t.Fatalf("Put = %v, want %v", err, ErrSizeMismatch)
+	}
+
+	// nothing is committed when the contents are cut short
+	if _, err := provider.Stat(ctx, "rocketchat_uploads", file); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -1,9 +1,10 @@
 package store
 
 import (
-	"errors"
+	"context"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/RocketChat/filestore-migrator/rocketchat"
 )
@@ -25,7 +26,7 @@ func (f *FileSystemStorageProvider) SetTempDirectory(dir string) {
 }
 
 // Download downloads a file from the storage provider and moves it to the temporary file store
-func (f *FileSystemStorageProvider) Download(fileCollection string, file rocketchat.File) (string, error) {
+func (f *FileSystemStorageProvider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
 	sourcePath := f.Location + "/" + file.ID
 	destinationPath := f.TempFileLocation + "/" + file.ID
 
@@ -33,6 +34,10 @@ func (f *FileSystemStorageProvider) Download(fileCollection string, file rocketc
 		return "", ErrNotFound
 	}
 
+	if cachedCopy(destinationPath, file) {
+		return destinationPath, nil
+	}
+
 	sF, err := os.Open(sourcePath)
 	if err != nil {
 		return "", err
@@ -40,24 +45,54 @@ func (f *FileSystemStorageProvider) Download(fileCollection string, file rocketc
 
 	defer sF.Close()
 
-	dF, err := os.Create(destinationPath)
-	if err != nil {
+	if err := writeFile(ctx, destinationPath, sF, int64(file.Size)); err != nil {
 		return "", err
 	}
 
-	defer dF.Close()
+	return destinationPath, nil
+}
+
+// Stat returns the size of the file without copying it
+func (f *FileSystemStorageProvider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	info, err := os.Stat(f.Location + "/" + file.ID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrNotFound
+		}
 
-	if _, err = io.Copy(dF, sF); err != nil {
-		return "", err
+		return 0, err
 	}
 
-	return destinationPath, nil
+	return info.Size(), nil
 }
 
-// Upload uploads a file from given path to the storage provider
-func (f *FileSystemStorageProvider) Upload(path string, filePath string, contentType string) error {
-	destinationPath := f.Location + "/" + path
+// Open returns a reader for the file stored under its id
+func (f *FileSystemStorageProvider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	sF, err := os.Open(f.Location + "/" + file.ID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, ErrNotFound
+		}
+
+		return nil, 0, err
+	}
+
+	info, err := sF.Stat()
+	if err != nil {
+		sF.Close()
+		return nil, 0, err
+	}
 
+	return &contextReadCloser{contextReader{ctx: ctx, r: sF}, sF}, info.Size(), nil
+}
+
+// Put writes the contents read from r to the path inside the storage location
+func (f *FileSystemStorageProvider) Put(ctx context.Context, path string, r io.Reader, size int64, contentType string) error {
+	return writeFile(ctx, f.Location+"/"+path, r, size)
+}
+
+// Upload uploads a file from given path to the storage provider
+func (f *FileSystemStorageProvider) Upload(ctx context.Context, path string, filePath string, contentType string) error {
 	sF, err := os.Open(filePath)
 	if err != nil {
 		return err
@@ -65,20 +100,47 @@ func (f *FileSystemStorageProvider) Upload(path string, filePath string, content
 
 	defer sF.Close()
 
-	dF, err := os.Create(destinationPath)
+	return f.Put(ctx, path, sF, -1, contentType)
+}
+
+// List calls fn for every file in the storage location. The .part files left by interrupted uploads are skipped
+func (f *FileSystemStorageProvider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	entries, err := os.ReadDir(f.Location)
 	if err != nil {
 		return err
 	}
 
-	defer dF.Close()
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	if _, err = io.Copy(dF, sF); err != nil {
-		return err
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".part") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(entry.Name(), info.Size()); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (s *FileSystemStorageProvider) Delete(file rocketchat.File, permanentelyDelete bool) error {
-	return errors.New("delete object method not implemented")
+// Delete removes the file stored under its id
+func (f *FileSystemStorageProvider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
+
+	if err := os.Remove(f.Location + "/" + file.ID); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+func TestFileSystemStorageProviderList(t *testing.T) {
+	provider := &FileSystemStorageProvider{Location: t.TempDir()}
+
+	files := map[string]string{
+		"file1":      "hello",
+		"file2":      "hello world",
+		"file3.part": "interrupted",
+	}
+
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(provider.Location, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(provider.Location, "folder"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := make(map[string]int64)
+
+	err := provider.List(context.Background(), "rocketchat_uploads", "", func(key string, size int64) error {
+		listed[key] = size
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"file1": 5, "file2": 11}
+
+	if !reflect.DeepEqual(listed, want) {
+		t.Fatalf("listed %v, want %v", listed, want)
+	}
+}
+
+func TestFileSystemStorageProviderDelete(t *testing.T) {
+	tests := []struct {
+		name               string
+		existing           bool
+		permanentelyDelete bool
+		wantExists         bool
+	}{
+		{name: "removes the file", existing: true, permanentelyDelete: true},
+		{name: "missing file", permanentelyDelete: true},
+		{name: "kept unless permanently deleted", existing: true, wantExists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &FileSystemStorageProvider{Location: t.TempDir()}
+			target := filepath.Join(provider.Location, "file1")
+
+			if tt.existing {
+				if err := os.WriteFile(target, []byte("hello"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := provider.Delete(context.Background(), "rocketchat_uploads", rocketchat.File{ID: "file1"}, tt.permanentelyDelete); err != nil {
+				t.Fatalf("Delete() = %v", err)
+			}
+
+			if _, err := os.Stat(target); (err == nil) != tt.wantExists {
+				t.Fatalf("file exists = %v, want %v", err == nil, tt.wantExists)
+			}
+		})
+	}
+}
@@ -3,13 +3,16 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/RocketChat/filestore-migrator/rocketchat"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 	"google.golang.org/api/storage/v1"
 )
 
@@ -30,27 +33,40 @@ func (g *GoogleStorageProvider) SetTempDirectory(dir string) {
 	g.TempFileLocation = dir
 }
 
-// Download downloads a file from the storage provider and moves it to the temporary file store
-func (g *GoogleStorageProvider) Download(fileCollection string, file rocketchat.File) (string, error) {
-	ctx := context.Background()
-
+func (g *GoogleStorageProvider) newService(ctx context.Context) (*storage.Service, error) {
 	cfg, err := google.JWTConfigFromJSON([]byte(g.JSONKey), "https://www.googleapis.com/auth/cloud-platform")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	c := cfg.Client(ctx)
+	return storage.NewService(ctx, option.WithHTTPClient(cfg.Client(ctx)))
+}
+
+// isNotFound reports whether err is the api telling the object doesn't exist
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return true
+	}
 
-	service, err := storage.New(c)
+	return strings.Contains(err.Error(), "No such object:")
+}
+
+// Download downloads a file from the storage provider and moves it to the temporary file store
+func (g *GoogleStorageProvider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	service, err := g.newService(ctx)
+	if err != nil {
+		return "", err
+	}
 
 	filePath := g.TempFileLocation + "/" + file.ID
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if !cachedCopy(filePath, file) {
 
-		getCall := service.Objects.Get(g.Bucket, file.GoogleStorage.Path)
+		getCall := service.Objects.Get(g.Bucket, file.GoogleStorage.Path).Context(ctx)
 		resp, err := getCall.Download()
 		if err != nil {
-			if strings.Contains(err.Error(), "No such object:") {
+			if isNotFound(err) {
 				return "", ErrNotFound
 			}
 
@@ -59,57 +75,115 @@ func (g *GoogleStorageProvider) Download(fileCollection string, file rocketchat.
 
 		defer resp.Body.Close()
 
-		f, err := os.Create(filePath)
-		if err != nil {
+		if err := writeFile(ctx, filePath, resp.Body, int64(file.Size)); err != nil {
 			return "", err
 		}
+	}
 
-		defer f.Close()
+	return filePath, nil
+}
 
-		if _, err = io.Copy(f, resp.Body); err != nil {
-			return "", err
+// Stat returns the size of the object referenced by the file without downloading it
+func (g *GoogleStorageProvider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	service, err := g.newService(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	object, err := service.Objects.Get(g.Bucket, file.GoogleStorage.Path).Context(ctx).Do()
+	if err != nil {
+		if isNotFound(err) {
+			return 0, ErrNotFound
 		}
+
+		return 0, err
 	}
 
-	return filePath, nil
+	return int64(object.Size), nil
 }
 
-// Upload uploads a file from given path to the storage provider
-func (g *GoogleStorageProvider) Upload(path string, filePath string, contentType string) error {
-	ctx := context.Background()
+// Open returns a reader streaming the object referenced by the file
+func (g *GoogleStorageProvider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	service, err := g.newService(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	cfg, err := google.JWTConfigFromJSON([]byte(g.JSONKey), "https://www.googleapis.com/auth/cloud-platform")
+	resp, err := service.Objects.Get(g.Bucket, file.GoogleStorage.Path).Context(ctx).Download()
+	if err != nil {
+		if isNotFound(err) {
+			return nil, 0, ErrNotFound
+		}
+
+		return nil, 0, err
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// Put uploads the contents read from r to the object path, unless size is negative it has to match
+func (g *GoogleStorageProvider) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	service, err := g.newService(ctx)
 	if err != nil {
 		return err
 	}
 
-	c := cfg.Client(ctx)
+	object := &storage.Object{
+		Name:        objectPath,
+		ContentType: contentType,
+	}
 
-	service, err := storage.New(c)
+	if _, err := service.Objects.Insert(g.Bucket, object).Media(&sizedReader{r: r, size: size}).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("problem uploading file to bucket: %w", err)
+	}
 
+	return nil
+}
+
+// Upload uploads a file from given path to the storage provider
+func (g *GoogleStorageProvider) Upload(ctx context.Context, path string, filePath string, contentType string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Println(err)
-		return errors.New("problem opening file to upload")
+		return fmt.Errorf("problem opening file to upload: %w", err)
 	}
 
 	defer file.Close()
 
-	object := &storage.Object{
-		Name: path,
+	return g.Put(ctx, path, file, -1, contentType)
+}
+
+// List calls fn for every object in the bucket under the prefix
+func (g *GoogleStorageProvider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	service, err := g.newService(ctx)
+	if err != nil {
+		return err
 	}
 
-	insertCall := service.Objects.Insert(g.Bucket, object).Media(file)
+	return service.Objects.List(g.Bucket).Prefix(prefix).Pages(ctx, func(objects *storage.Objects) error {
+		for _, object := range objects.Items {
+			if err := fn(object.Name, int64(object.Size)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete removes the object referenced by file.GoogleStorage.Path
+func (g *GoogleStorageProvider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
 
-	_, err = insertCall.Do()
+	service, err := g.newService(ctx)
 	if err != nil {
-		log.Println(err)
-		return errors.New("problem uploading file to bucket")
+		return err
 	}
 
-	return nil
-}
+	if err := service.Objects.Delete(g.Bucket, file.GoogleStorage.Path).Context(ctx).Do(); err != nil && !isNotFound(err) {
+		return err
+	}
 
-func (s *GoogleStorageProvider) Delete(file rocketchat.File, permanentelyDelete bool) error {
-	return errors.New("delete object method not implemented")
+	return nil
 }
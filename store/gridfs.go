@@ -1,10 +1,16 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -17,6 +23,8 @@ type GridFSProvider struct {
 	TempFileLocation string
 
 	Buckets map[string]*gridfs.Bucket
+
+	bucketsMu sync.Mutex
 }
 
 // StoreType returns the name of the store
@@ -24,14 +32,27 @@ func (g *GridFSProvider) StoreType() string {
 	return "GridFS"
 }
 
-func (g *GridFSProvider) addBucket(bucketName string) (*gridfs.Bucket, error) {
-	if bucket, err := gridfs.NewBucket(g.Session.Client().Database(g.Database), options.GridFSBucket().SetName(bucketName)); err != nil {
+// getBucket returns the bucket with the given name, creating it if needed
+func (g *GridFSProvider) getBucket(bucketName string) (*gridfs.Bucket, error) {
+	g.bucketsMu.Lock()
+	defer g.bucketsMu.Unlock()
+
+	if bucket, ok := g.Buckets[bucketName]; ok {
+		return bucket, nil
+	}
+
+	bucket, err := gridfs.NewBucket(g.Session.Client().Database(g.Database), options.GridFSBucket().SetName(bucketName))
+	if err != nil {
 		return nil, err
-	} else {
-		g.Buckets[bucketName] = bucket
 	}
 
-	return g.Buckets[bucketName], nil
+	if g.Buckets == nil {
+		g.Buckets = make(map[string]*gridfs.Bucket)
+	}
+
+	g.Buckets[bucketName] = bucket
+
+	return bucket, nil
 }
 
 // SetTempDirectory allows for the setting of the directory that will be used for temporary file store during operations
@@ -40,44 +61,166 @@ func (g *GridFSProvider) SetTempDirectory(dir string) {
 }
 
 // Download downloads a file from the storage provider and moves it to the temporary file store
-func (g *GridFSProvider) Download(fileCollection string, file rocketchat.File) (string, error) {
-
-	var (
-		bucket *gridfs.Bucket
-		ok     bool
-		err    error
-	)
-	if bucket, ok = g.Buckets[fileCollection]; !ok {
-		bucket, err = g.addBucket(fileCollection)
+func (g *GridFSProvider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	filePath := g.TempFileLocation + "/" + file.ID
+
+	if !cachedCopy(filePath, file) {
+		stream, _, err := g.Open(ctx, fileCollection, file)
 		if err != nil {
 			return "", err
 		}
+
+		defer stream.Close()
+
+		if err := writeFile(ctx, filePath, stream, int64(file.Size)); err != nil {
+			return "", err
+		}
 	}
 
-	filePath := g.TempFileLocation + "/" + file.ID
+	return filePath, nil
+}
+
+// Stat returns the length of the file stored in the bucket without downloading it
+func (g *GridFSProvider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	bucket, err := g.getBucket(fileCollection)
+	if err != nil {
+		return 0, err
+	}
 
-	if _, err = os.Stat(filePath); os.IsNotExist(err) {
+	cursor, err := bucket.FindContext(ctx, bson.M{"_id": file.ID})
+	if err != nil {
+		return 0, err
+	}
 
-		f, err := os.Create(filePath)
-		if err != nil {
-			return "", err
+	defer cursor.Close(context.Background())
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return 0, err
 		}
 
-		if _, err = bucket.DownloadToStream(file.ID, f); err != nil {
-			return "", err
+		return 0, ErrNotFound
+	}
+
+	var stored struct {
+		Length int64 `bson:"length"`
+	}
+
+	if err := cursor.Decode(&stored); err != nil {
+		return 0, err
+	}
+
+	return stored.Length, nil
+}
+
+// Open returns a reader streaming the file out of the bucket
+func (g *GridFSProvider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	bucket, err := g.getBucket(fileCollection)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stream, err := bucket.OpenDownloadStream(file.ID)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, 0, ErrNotFound
 		}
 
-		f.Close()
+		return nil, 0, err
 	}
 
-	return filePath, nil
+	return &contextReadCloser{contextReader{ctx: ctx, r: stream}, stream}, stream.GetFile().Length, nil
 }
 
-// Upload uploads a file from given path to the storage provider (not implemented)
-func (g *GridFSProvider) Upload(path string, filePath string, contentType string) error {
-	return errors.New("unimplemented")
+// Put stores the contents read from r in the bucket, unless size is negative it has to match.
+// The objectPath is expected to be in the form of <bucket>/<file id>, matching the
+// rocketchat_uploads / rocketchat_avatars buckets used by Rocket.Chat
+func (g *GridFSProvider) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	index := strings.LastIndex(objectPath, "/")
+	if index <= 0 || index == len(objectPath)-1 {
+		return errors.New("invalid gridfs object path")
+	}
+
+	bucketName := objectPath[:index]
+	fileID := objectPath[index+1:]
+
+	bucket, err := g.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	// Remove any previous copy so re-running a migration doesn't fail on a duplicate _id
+	if err := bucket.DeleteContext(ctx, fileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+
+	// Rocket.Chat uses the file id as the filename in GridFS.
+	// The upload is aborted, removing the chunks written so far, when ctx is cancelled
+	if err := bucket.UploadFromStreamWithID(fileID, fileID, &contextReader{ctx: ctx, r: &sizedReader{r: r, size: size}}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Upload uploads a file from given path to the storage provider, see Put for the expected objectPath
+func (g *GridFSProvider) Upload(ctx context.Context, objectPath string, filePath string, contentType string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return g.Put(ctx, objectPath, f, -1, contentType)
+}
+
+// List calls fn for every file in the bucket
+func (g *GridFSProvider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	bucket, err := g.getBucket(fileCollection)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := bucket.FindContext(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		var stored struct {
+			ID     interface{} `bson:"_id"`
+			Length int64       `bson:"length"`
+		}
+
+		if err := cursor.Decode(&stored); err != nil {
+			return err
+		}
+
+		if err := fn(fmt.Sprint(stored.ID), stored.Length); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
 }
 
-func (s *GridFSProvider) Delete(file rocketchat.File, permanentelyDelete bool) error {
-	return errors.New("unimplemented")
+// Delete removes the file and its chunks from the bucket
+func (g *GridFSProvider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
+
+	bucket, err := g.getBucket(fileCollection)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+
+	return nil
 }
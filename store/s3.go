@@ -4,9 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
-	"os"
-	"strings"
+	"net/http"
 
 	"github.com/RocketChat/filestore-migrator/rocketchat"
 	minio "github.com/minio/minio-go/v7"
@@ -34,22 +32,26 @@ func (s *S3Provider) SetTempDirectory(dir string) {
 	s.TempFileLocation = dir
 }
 
-// Download will download the file to temp file store
-func (s *S3Provider) Download(fileCollection string, file rocketchat.File) (string, error) {
-	minioClient, err := minio.New(s.Endpoint, &minio.Options{
+func (s *S3Provider) newClient() (*minio.Client, error) {
+	return minio.New(s.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(s.AccessID, s.AccessKey, ""),
 		Secure: s.UseSSL,
 		Region: s.Region,
 	})
+}
+
+// Download will download the file to temp file store
+func (s *S3Provider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	minioClient, err := s.newClient()
 	if err != nil {
 		return "", err
 	}
 
 	filePath := s.TempFileLocation + "/" + file.ID
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if !cachedCopy(filePath, file) {
 		object, err := minioClient.GetObject(
-			context.Background(),
+			ctx,
 			s.Bucket,
 			file.AmazonS3.Path,
 			minio.GetObjectOptions{},
@@ -58,35 +60,95 @@ func (s *S3Provider) Download(fileCollection string, file rocketchat.File) (stri
 			return "", err
 		}
 
-		f, err := os.Create(filePath)
-		if err != nil {
+		defer object.Close()
+
+		if err := writeFile(ctx, filePath, object, int64(file.Size)); err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				return "", ErrNotFound
+			}
+
 			return "", err
 		}
+	}
 
-		defer f.Close()
+	return filePath, nil
+}
 
-		if _, err = io.Copy(f, object); err != nil {
-			return "", err
+// Stat returns the size of the object referenced by the file without downloading it
+func (s *S3Provider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	minioClient, err := s.newClient()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := minioClient.StatObject(ctx, s.Bucket, file.AmazonS3.Path, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return 0, ErrNotFound
 		}
 
+		return 0, err
 	}
 
-	return filePath, nil
+	return info.Size, nil
+}
+
+// Open returns a reader streaming the object referenced by the file
+func (s *S3Provider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	minioClient, err := s.newClient()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	object, err := minioClient.GetObject(ctx, s.Bucket, file.AmazonS3.Path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, 0, ErrNotFound
+		}
+
+		return nil, 0, err
+	}
+
+	return object, info.Size, nil
+}
+
+// Put uploads the contents read from r to the object path
+func (s *S3Provider) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	minioClient, err := s.newClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = minioClient.PutObject(
+		ctx,
+		s.Bucket,
+		objectPath,
+		r,
+		size,
+		minio.PutObjectOptions{
+			ContentType: contentType,
+		},
+	)
+
+	return err
 }
 
 // Upload will upload the file from given file path
-func (s *S3Provider) Upload(objectPath string, filePath string, contentType string) error {
-	minioClient, err := minio.New(s.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(s.AccessID, s.AccessKey, ""),
-		Secure: s.UseSSL,
-		Region: s.Region,
-	})
+func (s *S3Provider) Upload(ctx context.Context, objectPath string, filePath string, contentType string) error {
+	minioClient, err := s.newClient()
 	if err != nil {
 		return err
 	}
 
 	_, err = minioClient.FPutObject(
-		context.Background(),
+		ctx,
 		s.Bucket,
 		objectPath,
 		filePath,
@@ -95,75 +157,57 @@ func (s *S3Provider) Upload(objectPath string, filePath string, contentType stri
 		},
 	)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return fmt.Errorf("problem uploading file to bucket: %w", err)
 	}
 
 	return nil
 }
 
-// Delete permanentely permanentely destroys an object specified by the
-// rocketFile.Amazons3.filepath
-func (s *S3Provider) Delete(file rocketchat.File, permanentelyDelete bool) error {
-	minioClient, err := minio.New(s.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(s.AccessID, s.AccessKey, ""),
-		Secure: s.UseSSL,
-		Region: s.Region,
-	})
+// List calls fn for every object in the bucket under the prefix
+func (s *S3Provider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	minioClient, err := s.newClient()
 	if err != nil {
 		return err
 	}
 
-	log.Printf("file.AmazonS3:\n %+v\n", file.AmazonS3)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// removes the bucket name from the Path if it exists
-	objectPrefix := strings.TrimPrefix(file.AmazonS3.Path, s.Bucket)
+	for object := range minioClient.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
 
-	// chan of objects withing the deployment object
-	objectsCh := make(chan string)
+		if err := fn(object.Key, object.Size); err != nil {
+			return err
+		}
+	}
 
-	//send object names thata are to be removed to objectsCh
-	go func() {
-		defer close(objectsCh)
-		recursive := true
+	return nil
+}
 
-		for object := range minioClient.ListObjects(
-			context.Background(),
-			s.Bucket,
-			minio.ListObjectsOptions{
-				Prefix:    objectPrefix,
-				Recursive: recursive,
-			},
-		) {
-			log.Printf("list objects: %s: %s\n", objectPrefix, object.Key)
-
-			if object.Err != nil {
-				log.Printf("object error: %v\n", object.Err)
-			}
+// Delete permanentely removes the object stored under the key recorded in file.AmazonS3.Path
+func (s *S3Provider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
 
-			if object.Key == "" {
-				continue
-			}
+	// an empty key would leave the object in place without telling
+	if file.AmazonS3.Path == "" {
+		return fmt.Errorf("could not remove object: no path recorded for file %s", file.ID)
+	}
 
-			if permanentelyDelete {
-				objectsCh <- object.Key
-			}
-		}
-	}()
-
-	if permanentelyDelete {
-		log.Println("permanentely deleting all the objects of the deployment")
-		for objName := range objectsCh {
-			if err := minioClient.RemoveObject(
-				context.Background(),
-				s.Bucket,
-				objName,
-				minio.RemoveObjectOptions{},
-			); err != nil {
-				return fmt.Errorf("could not remove object: %s: %s: %w", s.Bucket, objName, err)
-			}
+	minioClient, err := s.newClient()
+	if err != nil {
+		return err
+	}
 
+	if err := minioClient.RemoveObject(ctx, s.Bucket, file.AmazonS3.Path, minio.RemoveObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil
 		}
+
+		return fmt.Errorf("could not remove object: %s: %s: %w", s.Bucket, file.AmazonS3.Path, err)
 	}
 
 	return nil
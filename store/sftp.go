@@ -0,0 +1,394 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPProvider provides methods to use a directory on a server reachable over SSH as a storage provider.
+// Like FileSystemStorageProvider, files are kept in the directory under their id. It authenticates with
+// the private key and the password that are set, or with the default keys of ~/.ssh when neither is,
+// checking the host key against the known hosts file, ~/.ssh/known_hosts by default
+type SFTPProvider struct {
+	Host                  string
+	Port                  int
+	User                  string
+	Password              string
+	KeyFile               string
+	KeyPassphrase         string
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+	Location              string
+	TempFileLocation      string
+
+	mu     sync.Mutex
+	client *sftp.Client
+}
+
+// StoreType returns the name of the store. Rocket.Chat has no SFTP store, it serves the
+// directory from where it is mounted through its FileSystem store
+func (s *SFTPProvider) StoreType() string {
+	return "FileSystem"
+}
+
+// SetTempDirectory allows for the setting of the directory that will be used for temporary file store during operations
+func (s *SFTPProvider) SetTempDirectory(dir string) {
+	s.TempFileLocation = dir
+}
+
+// sshConfig builds the client configuration from the credentials and the known hosts
+func (s *SFTPProvider) sshConfig() (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		User:    s.User,
+		Timeout: 30 * time.Second,
+	}
+
+	if s.KeyFile != "" {
+		key, err := os.ReadFile(s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("problem reading the private key: %w", err)
+		}
+
+		var signer ssh.Signer
+		if s.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(s.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("problem parsing the private key: %w", err)
+		}
+
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+
+	if s.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(s.Password))
+	}
+
+	if len(config.Auth) == 0 {
+		signers, err := defaultSigners()
+		if err != nil {
+			return nil, err
+		}
+
+		config.Auth = append(config.Auth, ssh.PublicKeys(signers...))
+	}
+
+	if s.InsecureIgnoreHostKey {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return config, nil
+	}
+
+	knownHostsFile := s.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("problem locating the known hosts file: %w", err)
+		}
+
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading the known hosts file: %w", err)
+	}
+
+	config.HostKeyCallback = callback
+
+	return config, nil
+}
+
+// defaultSigners returns the unencrypted keys found at the default locations of ~/.ssh
+func defaultSigners() ([]ssh.Signer, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("problem locating the private keys: %w", err)
+	}
+
+	var signers []ssh.Signer
+
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			continue
+		}
+
+		signers = append(signers, signer)
+	}
+
+	if len(signers) == 0 {
+		return nil, errors.New("no password, key file or usable default private key in ~/.ssh")
+	}
+
+	return signers, nil
+}
+
+// getClient returns the client of the connection to the server, connecting on first use and
+// again once the connection is lost. The client is shared by the concurrent transfers
+func (s *SFTPProvider) getClient(ctx context.Context) (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	config, err := s.sshConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	port := s.Port
+	if port == 0 {
+		port = 22
+	}
+
+	address := net.JoinHostPort(s.Host, strconv.Itoa(port))
+
+	dialer := &net.Dialer{Timeout: config.Timeout}
+
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, chans, reqs, err := ssh.NewClientConn(netConn, address, config)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	sshClient := ssh.NewClient(conn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+
+	s.client = client
+
+	// forget the client once the connection is gone so the next operation connects again
+	go func() {
+		sshClient.Wait()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.client == client {
+			s.client = nil
+		}
+	}()
+
+	return client, nil
+}
+
+// remotePath returns the path on the server of the object path
+func (s *SFTPProvider) remotePath(objectPath string) string {
+	return path.Join(s.Location, objectPath)
+}
+
+// Download downloads a file from the storage provider and moves it to the temporary file store
+func (s *SFTPProvider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	filePath := s.TempFileLocation + "/" + file.ID
+
+	if !cachedCopy(filePath, file) {
+		reader, _, err := s.Open(ctx, fileCollection, file)
+		if err != nil {
+			return "", err
+		}
+
+		defer reader.Close()
+
+		if err := writeFile(ctx, filePath, reader, int64(file.Size)); err != nil {
+			return "", err
+		}
+	}
+
+	return filePath, nil
+}
+
+// Stat returns the size of the file on the server without downloading it
+func (s *SFTPProvider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := client.Stat(s.remotePath(file.ID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrNotFound
+		}
+
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// Open returns a reader for the file stored under its id
+func (s *SFTPProvider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sF, err := client.Open(s.remotePath(file.ID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, ErrNotFound
+		}
+
+		return nil, 0, err
+	}
+
+	info, err := sF.Stat()
+	if err != nil {
+		sF.Close()
+		return nil, 0, err
+	}
+
+	return &contextReadCloser{contextReader{ctx: ctx, r: sF}, sF}, info.Size(), nil
+}
+
+// Put writes the contents read from r to the path inside the storage location. They are written to
+// a .part file first and only renamed once fully copied, unless size is negative it has to match
+func (s *SFTPProvider) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	remotePath := s.remotePath(objectPath)
+	partPath := remotePath + ".part"
+
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("problem creating the folder of the file: %w", err)
+	}
+
+	f, err := client.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("problem uploading file to server: %w", err)
+	}
+
+	written, err := io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if err != nil {
+		f.Close()
+		client.Remove(partPath)
+
+		return fmt.Errorf("problem uploading file to server: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		client.Remove(partPath)
+		return fmt.Errorf("problem uploading file to server: %w", err)
+	}
+
+	if size >= 0 && written != size {
+		client.Remove(partPath)
+		return fmt.Errorf("%w: copied %d bytes, expected %d", ErrSizeMismatch, written, size)
+	}
+
+	// a plain rename fails when the file exists, so the existing file is only removed beforehand
+	// when the server can't replace it with the posix one
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		if err := client.PosixRename(partPath, remotePath); err != nil {
+			client.Remove(partPath)
+			return fmt.Errorf("problem uploading file to server: %w", err)
+		}
+
+		return nil
+	}
+
+	client.Remove(remotePath)
+
+	if err := client.Rename(partPath, remotePath); err != nil {
+		client.Remove(partPath)
+		return fmt.Errorf("problem uploading file to server: %w", err)
+	}
+
+	return nil
+}
+
+// Upload uploads a file from given path to the storage provider
+func (s *SFTPProvider) Upload(ctx context.Context, objectPath string, filePath string, contentType string) error {
+	sF, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+
+	defer sF.Close()
+
+	return s.Put(ctx, objectPath, sF, -1, contentType)
+}
+
+// List calls fn for every file in the storage location. The .part files left by interrupted uploads are skipped
+func (s *SFTPProvider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries, err := client.ReadDir(s.Location)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".part") {
+			continue
+		}
+
+		if err := fn(entry.Name(), entry.Size()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the file stored under its id
+func (s *SFTPProvider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
+
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Remove(s.remotePath(file.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
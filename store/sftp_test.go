@@ -0,0 +1,384 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSFTPProvider starts an SSH server serving SFTP on a random local port and
+// returns a provider storing its files in a temporary directory through it
+func newTestSFTPProvider(t *testing.T) *SFTPProvider {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "rocketchat" && string(password) == "secret" {
+				return nil, nil
+			}
+
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSFTP(conn, config)
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+
+	provider := &SFTPProvider{
+		Host:                  address.IP.String(),
+		Port:                  address.Port,
+		User:                  "rocketchat",
+		Password:              "secret",
+		InsecureIgnoreHostKey: true,
+		Location:              t.TempDir(),
+		TempFileLocation:      t.TempDir(),
+	}
+
+	t.Cleanup(func() {
+		if provider.client != nil {
+			provider.client.Close()
+		}
+	})
+
+	return provider
+}
+
+// serveSFTP answers the sftp subsystem requests of the sessions opened on the connection
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				req.Reply(req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}(requests)
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			channel.Close()
+			continue
+		}
+
+		server.Serve()
+		server.Close()
+	}
+}
+
+// failingReader returns its contents followed by an error instead of EOF
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+
+	return n, err
+}
+
+func TestSFTPProviderPut(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		reader   func() io.Reader
+		size     int64
+		wantErr  error
+		want     string
+	}{
+		{
+			name:   "matching size",
+			reader: func() io.Reader { return strings.NewReader("hello") },
+			size:   5,
+			want:   "hello",
+		},
+		{
+			name:   "unchecked size",
+			reader: func() io.Reader { return strings.NewReader("hello") },
+			size:   -1,
+			want:   "hello",
+		},
+		{
+			name:     "replaces the existing file",
+			existing: "previous contents",
+			reader:   func() io.Reader { return strings.NewReader("hello") },
+			size:     5,
+			want:     "hello",
+		},
+		{
+			name:     "size mismatch",
+			existing: "previous contents",
+			reader:   func() io.Reader { return strings.NewReader("hell") },
+			size:     5,
+			wantErr:  ErrSizeMismatch,
+			want:     "previous contents",
+		},
+		{
+			name:    "failed copy",
+			reader:  func() io.Reader { return &failingReader{strings.NewReader("hel")} },
+			size:    5,
+			wantErr: errors.New("connection reset"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestSFTPProvider(t)
+			target := filepath.Join(provider.Location, "file1")
+
+			if tt.existing != "" {
+				if err := os.WriteFile(target, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := provider.Put(context.Background(), "file1", tt.reader(), tt.size, "text/plain")
+
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != nil && err == nil:
+				t.Fatalf("expected error %v", tt.wantErr)
+			case errors.Is(tt.wantErr, ErrSizeMismatch) && !errors.Is(err, ErrSizeMismatch):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			// the contents only replace the file once fully copied
+			if _, err := os.Stat(target + ".part"); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf(".part file left behind: %v", err)
+			}
+
+			data, err := os.ReadFile(target)
+			if tt.want == "" {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("file written: %q, %v", data, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Fatalf("contents = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestSFTPProviderPutKeepsExistingOnFailedRename(t *testing.T) {
+	provider := newTestSFTPProvider(t)
+	target := filepath.Join(provider.Location, "file1")
+
+	// the server replaces files through posix-rename, which fails on a directory
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.Put(context.Background(), "file1", strings.NewReader("hello"), 5, "text/plain"); err == nil {
+		t.Fatal("expected the rename to fail")
+	}
+
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		t.Fatalf("existing directory removed: %v", err)
+	}
+
+	if _, err := os.Stat(target + ".part"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf(".part file left behind: %v", err)
+	}
+}
+
+func TestSFTPProviderOpenStat(t *testing.T) {
+	provider := newTestSFTPProvider(t)
+
+	if err := os.WriteFile(filepath.Join(provider.Location, "file1"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		file    rocketchat.File
+		want    string
+		wantErr error
+	}{
+		{name: "existing file", file: rocketchat.File{ID: "file1"}, want: "hello"},
+		{name: "missing file", file: rocketchat.File{ID: "file2"}, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := provider.Stat(ctx, "rocketchat_uploads", tt.file)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Stat err = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && size != int64(len(tt.want)) {
+				t.Fatalf("Stat size = %d, want %d", size, len(tt.want))
+			}
+
+			reader, size, err := provider.Open(ctx, "rocketchat_uploads", tt.file)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open err = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			defer reader.Close()
+
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want || size != int64(len(tt.want)) {
+				t.Fatalf("Open = %q (%d bytes), want %q", data, size, tt.want)
+			}
+		})
+	}
+}
+
+func TestSFTPProviderList(t *testing.T) {
+	provider := newTestSFTPProvider(t)
+
+	files := map[string]string{
+		"file1":      "hello",
+		"file2":      "hello world",
+		"file3.part": "interrupted",
+	}
+
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(provider.Location, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(provider.Location, "folder"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := make(map[string]int64)
+
+	err := provider.List(context.Background(), "rocketchat_uploads", "", func(key string, size int64) error {
+		listed[key] = size
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"file1": 5, "file2": 11}
+
+	if !reflect.DeepEqual(listed, want) {
+		t.Fatalf("listed %v, want %v", listed, want)
+	}
+}
+
+func TestSFTPProviderDelete(t *testing.T) {
+	tests := []struct {
+		name               string
+		existing           bool
+		permanentelyDelete bool
+		wantKept           bool
+	}{
+		{name: "existing file", existing: true, permanentelyDelete: true},
+		{name: "missing file", permanentelyDelete: true},
+		{name: "not permanent", existing: true, wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestSFTPProvider(t)
+			target := filepath.Join(provider.Location, "file1")
+
+			if tt.existing {
+				if err := os.WriteFile(target, []byte("hello"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := provider.Delete(context.Background(), "rocketchat_uploads", rocketchat.File{ID: "file1"}, tt.permanentelyDelete)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := os.ReadFile(target)
+			if tt.wantKept {
+				if err != nil || !bytes.Equal(data, []byte("hello")) {
+					t.Fatalf("file not kept: %q, %v", data, err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("file not removed: %v", err)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
 
 	"github.com/RocketChat/filestore-migrator/rocketchat"
 )
@@ -9,6 +13,8 @@ import (
 var (
 	// ErrNotFound is returned when a file is not found
 	ErrNotFound = errors.New("not found")
+	// ErrSizeMismatch is returned when the bytes copied don't match the size of the file
+	ErrSizeMismatch = errors.New("size mismatch")
 )
 
 // Provider describes the basic contract provided to access a static content storage provider.
@@ -16,11 +22,128 @@ type Provider interface {
 	// StoreType returns the name of the store
 	StoreType() string
 	// Upload uploads a file from given path to the storage provider
-	Upload(objectPath string, filePath string, contentType string) error
-	// Download downloads a file from the storage provider and moves it to the temporary file store
-	Download(fileCollection string, file rocketchat.File) (string, error)
+	Upload(ctx context.Context, objectPath string, filePath string, contentType string) error
+	// Download downloads a file from the storage provider and moves it to the temporary file store.
+	// Nothing is left in the temporary file store when the download fails, is cancelled or doesn't
+	// match the size of the file. A copy left by a previous download is reused when its size matches
+	Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error)
+	// Stat returns the size of the stored object for the file without downloading it, or ErrNotFound
+	Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error)
+	// List calls fn with the key and size of every object stored under prefix. Providers keyed by file id ignore the prefix
+	List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error
 	// SetTempDirectory allows for the setting of the directory that will be used for temporary file store during operations
 	SetTempDirectory(subdir string)
+	// Delete removes the stored object of the file. Nothing is removed unless permanentelyDelete is set
+	Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error
+}
+
+// StreamProvider is implemented by providers able to transfer files without staging them in the temporary file store
+type StreamProvider interface {
+	// Open returns a reader for the file contents along with its size. Reads fail once ctx is cancelled
+	Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error)
+	// Put stores the contents read from r at the object path. Unless size is negative nothing is stored
+	// when the contents don't match it, ErrSizeMismatch being returned
+	Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error
+}
+
+// ObjectPathProvider is implemented by providers keeping the files of every store in one folder,
+// where the path of a file is only known to the provider
+type ObjectPathProvider interface {
+	// ObjectPath returns the path the file with the given id is stored at
+	ObjectPath(id string) string
+}
+
+// contextReader fails reads once its context is cancelled, so copies from readers that
+// don't take a context stop in between two reads
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+// sizedReader fails the read reaching the end of r, or going past size, when the bytes read don't
+// match size so an upload fed from it is aborted instead of storing a truncated copy. A negative size isn't checked
+type sizedReader struct {
+	r    io.Reader
+	size int64
+	n    int64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+
+	if s.size >= 0 && (s.n > s.size || (err == io.EOF && s.n != s.size)) {
+		return n, fmt.Errorf("%w: copied %d bytes, expected %d", ErrSizeMismatch, s.n, s.size)
+	}
+
+	return n, err
+}
+
+// contextReadCloser is a contextReader that can be closed
+type contextReadCloser struct {
+	contextReader
+	io.Closer
+}
+
+// writeFile writes the contents read from r to filePath. They are written to filePath.part first
+// and only renamed to filePath once fully copied, so a copy that fails, is cancelled or is cut
+// short by a crash never leaves a truncated file behind. Unless size is negative the number of
+// bytes copied has to match it
+func writeFile(ctx context.Context, filePath string, r io.Reader, size int64) error {
+	partPath := filePath + ".part"
+
+	f, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if err != nil {
+		f.Close()
+		os.Remove(partPath)
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	if size >= 0 && written != size {
+		os.Remove(partPath)
+		return fmt.Errorf("%w: copied %d bytes, expected %d", ErrSizeMismatch, written, size)
+	}
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	return nil
+}
+
+// cachedCopy reports whether filePath already holds a complete copy of the file left by a
+// previous download. A copy whose size doesn't match the file is removed so it is downloaded again
+func cachedCopy(filePath string, file rocketchat.File) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+
+	if info.Size() == int64(file.Size) {
+		return true
+	}
+
+	os.Remove(filePath)
 
-	Delete(file rocketchat.File, permanentelyDelete bool) error
+	return false
 }
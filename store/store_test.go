@@ -0,0 +1,46 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSizedReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		size     int64
+		wantErr  error
+	}{
+		{name: "matching size", contents: "hello", size: 5},
+		{name: "unchecked size", contents: "hello", size: -1},
+		{name: "empty", contents: "", size: 0},
+		{name: "short", contents: "hell", size: 5, wantErr: ErrSizeMismatch},
+		{name: "long", contents: "hello!", size: 5, wantErr: ErrSizeMismatch},
+		{name: "empty but expected", contents: "", size: 5, wantErr: ErrSizeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := io.ReadAll(&sizedReader{r: strings.NewReader(tt.contents), size: tt.size})
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(data) != tt.contents {
+				t.Fatalf("read %q, want %q", data, tt.contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+)
+
+// WebDAVProvider provides methods to use a WebDAV server as a storage provider. Like Rocket.Chat,
+// the files of every store are kept in the upload folder, named after their id
+type WebDAVProvider struct {
+	ServerURL        string
+	Username         string
+	Password         string
+	UploadFolderPath string
+	TempFileLocation string
+	Client           *http.Client
+}
+
+// HTTPStatusError is returned when a server answers a request with an unexpected status
+type HTTPStatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// StoreType returns the name of the store
+func (w *WebDAVProvider) StoreType() string {
+	return "Webdav"
+}
+
+// SetTempDirectory allows for the setting of the directory that will be used for temporary file store during operations
+func (w *WebDAVProvider) SetTempDirectory(dir string) {
+	w.TempFileLocation = dir
+}
+
+// ObjectPath returns the path Rocket.Chat gives on the server to the file with the given id
+func (w *WebDAVProvider) ObjectPath(id string) string {
+	folder := strings.Trim(w.UploadFolderPath, "/")
+	if folder == "" {
+		return id
+	}
+
+	return folder + "/" + id
+}
+
+// filePath returns the path on the server of the file, the one recorded in its document if any
+func (w *WebDAVProvider) filePath(file rocketchat.File) string {
+	if file.Webdav.Path != "" {
+		return file.Webdav.Path
+	}
+
+	return w.ObjectPath(file.ID)
+}
+
+// newRequest returns a request for the path on the server, authenticated when credentials are set
+func (w *WebDAVProvider) newRequest(ctx context.Context, method string, objectPath string, body io.Reader) (*http.Request, error) {
+	target := strings.TrimSuffix(w.ServerURL, "/") + "/" + (&url.URL{Path: strings.TrimPrefix(objectPath, "/")}).EscapedPath()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Username != "" || w.Password != "" {
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+
+	return req, nil
+}
+
+// send sends the request. Any answer but the expected statuses is closed and returned as an
+// HTTPStatusError, a 404 being returned as ErrNotFound
+func (w *WebDAVProvider) send(req *http.Request, objectPath string, expected ...int) (*http.Response, error) {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	return nil, &HTTPStatusError{Method: req.Method, Path: objectPath, StatusCode: resp.StatusCode}
+}
+
+// do sends a request without body for the path on the server, see send
+func (w *WebDAVProvider) do(ctx context.Context, method string, objectPath string, expected ...int) (*http.Response, error) {
+	req, err := w.newRequest(ctx, method, objectPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.send(req, objectPath, expected...)
+}
+
+// Download downloads a file from the storage provider and moves it to the temporary file store
+func (w *WebDAVProvider) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	filePath := w.TempFileLocation + "/" + file.ID
+
+	if !cachedCopy(filePath, file) {
+		reader, _, err := w.Open(ctx, fileCollection, file)
+		if err != nil {
+			return "", err
+		}
+
+		defer reader.Close()
+
+		if err := writeFile(ctx, filePath, reader, int64(file.Size)); err != nil {
+			return "", err
+		}
+	}
+
+	return filePath, nil
+}
+
+// Stat returns the size of the file on the server without downloading it
+func (w *WebDAVProvider) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	resp, err := w.do(ctx, http.MethodHead, w.filePath(file), http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+
+	resp.Body.Close()
+
+	return resp.ContentLength, nil
+}
+
+// Open returns a reader streaming the file from the server
+func (w *WebDAVProvider) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	resp, err := w.do(ctx, http.MethodGet, w.filePath(file), http.StatusOK)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// makeCollections creates the collections holding the object path that don't exist yet
+func (w *WebDAVProvider) makeCollections(ctx context.Context, objectPath string) error {
+	dir := path.Dir(strings.Trim(objectPath, "/"))
+	if dir == "." {
+		return nil
+	}
+
+	collection := ""
+
+	for _, segment := range strings.Split(dir, "/") {
+		collection += segment + "/"
+
+		// 405 is the answer for a collection that already exists
+		resp, err := w.do(ctx, "MKCOL", collection, http.StatusCreated, http.StatusMethodNotAllowed)
+		if err != nil {
+			return err
+		}
+
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+// Put uploads the contents read from r to the object path, creating the folders holding it
+func (w *WebDAVProvider) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	if err := w.makeCollections(ctx, objectPath); err != nil {
+		return fmt.Errorf("problem creating the folder of the file: %w", err)
+	}
+
+	req, err := w.newRequest(ctx, http.MethodPut, objectPath, r)
+	if err != nil {
+		return err
+	}
+
+	// a known length spares servers that don't accept chunked uploads
+	if size >= 0 {
+		req.ContentLength = size
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := w.send(req, objectPath, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return fmt.Errorf("problem uploading file to server: %w", err)
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+// Upload uploads a file from given path to the storage provider
+func (w *WebDAVProvider) Upload(ctx context.Context, objectPath string, filePath string, contentType string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("problem opening file to upload: %w", err)
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("problem opening file to upload: %w", err)
+	}
+
+	return w.Put(ctx, objectPath, file, info.Size(), contentType)
+}
+
+// propfindBody asks for the properties telling files from folders and their size
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/></prop></propfind>`
+
+// propfindResponse is a resource of the answer to a PROPFIND request
+type propfindResponse struct {
+	Href          string    `xml:"href"`
+	ContentLength int64     `xml:"propstat>prop>getcontentlength"`
+	Collection    *struct{} `xml:"propstat>prop>resourcetype>collection"`
+}
+
+// List calls fn for every file in the upload folder, keyed by its name. The prefix is ignored as the files are keyed by id
+func (w *WebDAVProvider) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	folder := strings.Trim(w.UploadFolderPath, "/") + "/"
+
+	req, err := w.newRequest(ctx, "PROPFIND", folder, strings.NewReader(propfindBody))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml")
+
+	resp, err := w.send(req, folder, http.StatusMultiStatus)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	var multistatus struct {
+		Responses []propfindResponse `xml:"response"`
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return fmt.Errorf("problem reading the files of the upload folder: %w", err)
+	}
+
+	for _, response := range multistatus.Responses {
+		if response.Collection != nil {
+			continue
+		}
+
+		href, err := url.PathUnescape(response.Href)
+		if err != nil {
+			href = response.Href
+		}
+
+		if err := fn(path.Base(strings.TrimSuffix(href, "/")), response.ContentLength); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the file from the server
+func (w *WebDAVProvider) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
+
+	resp, err := w.do(ctx, http.MethodDelete, w.filePath(file), http.StatusOK, http.StatusNoContent, http.StatusAccepted)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
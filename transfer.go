@@ -0,0 +1,155 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/RocketChat/filestore-migrator/store"
+)
+
+// sourceError wraps errors reading a file from the source store so they can be told
+// apart from errors writing it to the destination
+type sourceError struct {
+	err error
+}
+
+func (e *sourceError) Error() string {
+	return e.err.Error()
+}
+
+func (e *sourceError) Unwrap() error {
+	return e.err
+}
+
+// countingReader counts the bytes read through it, failing the read reaching the end of r, or going
+// past size, when they don't match size. The mismatch is kept so it can be told apart from the errors
+// of the destination reading it
+type countingReader struct {
+	r        io.Reader
+	size     int64
+	n        int64
+	mismatch error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	if c.n > c.size || (err == io.EOF && c.n != c.size) {
+		c.mismatch = fmt.Errorf("%w: copied %d bytes, expected %d", store.ErrSizeMismatch, c.n, c.size)
+		return n, c.mismatch
+	}
+
+	return n, err
+}
+
+// transferFile copies the file from the source store to objectPath in the destination store and returns
+// the number of bytes transferred. When both stores support streaming the file is piped straight through,
+// otherwise it is staged in the temp file location and removed once uploaded.
+// Transient errors are retried following the retry policy, counting the retries in the event
+func (m *Migrate) transferFile(ctx context.Context, event *fileEvent, file rocketchat.File, objectPath string) (int64, error) {
+	source, sourceStreams := m.sourceStore.(store.StreamProvider)
+	destination, destinationStreams := m.destinationStore.(store.StreamProvider)
+
+	if sourceStreams && destinationStreams {
+		var transferred int64
+
+		start := time.Now()
+		err := m.retry(ctx, event, func() error {
+			reader, _, err := source.Open(ctx, m.fileCollectionName, file)
+			if err != nil {
+				return &sourceError{err}
+			}
+
+			defer reader.Close()
+
+			// the destination is given the size recorded in the database so it aborts an upload that doesn't match it
+			counter := &countingReader{r: reader, size: int64(file.Size)}
+			err = destination.Put(ctx, objectPath, counter, int64(file.Size), file.Type)
+
+			// a destination reading exactly the size it was given never sees the bytes the source holds beyond it
+			if err == nil {
+				_, _ = counter.Read(make([]byte, 1))
+			}
+
+			transferred = counter.n
+
+			// a size mismatch is down to the source handing over fewer or more bytes than recorded, as for a download
+			if counter.mismatch != nil {
+				return &sourceError{counter.mismatch}
+			}
+
+			if errors.Is(err, store.ErrSizeMismatch) {
+				return &sourceError{err}
+			}
+
+			if err != nil {
+				return err
+			}
+
+			// the copy is only complete when it holds every byte recorded in the database
+			if counter.n != int64(file.Size) {
+				return &sourceError{fmt.Errorf("%w: copied %d bytes, expected %d", store.ErrSizeMismatch, counter.n, file.Size)}
+			}
+
+			return nil
+		})
+		if err != nil {
+			var srcErr *sourceError
+			if errors.As(err, &srcErr) {
+				return transferred, err
+			}
+
+			return transferred, fmt.Errorf("%w: %w", ErrDestinationUnreachable, err)
+		}
+
+		m.metrics.observe(m.storeName, phaseTransfer, time.Since(start))
+
+		return transferred, nil
+	}
+
+	var downloadedPath string
+
+	start := time.Now()
+	err := m.retry(ctx, event, func() error {
+		var err error
+		downloadedPath, err = m.sourceStore.Download(ctx, m.fileCollectionName, file)
+
+		return err
+	})
+	if err != nil {
+		return 0, &sourceError{err}
+	}
+
+	m.metrics.observe(m.storeName, eventDownload, time.Since(start))
+
+	if err := m.journal.record(file.ID, phaseDownloaded, ""); err != nil {
+		return 0, err
+	}
+
+	var size int64
+	if info, err := os.Stat(downloadedPath); err == nil {
+		size = info.Size()
+	}
+
+	start = time.Now()
+	err = m.retry(ctx, event, func() error {
+		return m.destinationStore.Upload(ctx, objectPath, downloadedPath, file.Type)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDestinationUnreachable, err)
+	}
+
+	m.metrics.observe(m.storeName, eventUpload, time.Since(start))
+
+	if err := os.Remove(downloadedPath); err != nil {
+		m.debugLog("Unable to remove temp file:", err)
+	}
+
+	return size, nil
+}
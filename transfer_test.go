@@ -0,0 +1,242 @@
+package migrator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/RocketChat/filestore-migrator/store"
+)
+
+// memoryStore is a provider keeping its objects in memory, keyed by file id when read and by object path when written
+type memoryStore struct {
+	storeType string
+	tempDir   string
+	// reportedSize overrides the size returned by Open when not zero
+	reportedSize int64
+	// exactReads makes Put read no more than the size it is given, as the S3 client does
+	exactReads bool
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	deleted []string
+}
+
+func newMemoryStore(storeType string, objects map[string][]byte) *memoryStore {
+	if objects == nil {
+		objects = make(map[string][]byte)
+	}
+
+	return &memoryStore{storeType: storeType, objects: objects}
+}
+
+func (s *memoryStore) object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+
+	return data, ok
+}
+
+func (s *memoryStore) StoreType() string {
+	return s.storeType
+}
+
+func (s *memoryStore) SetTempDirectory(dir string) {
+	s.tempDir = dir
+}
+
+func (s *memoryStore) Upload(ctx context.Context, objectPath string, filePath string, contentType string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[objectPath] = data
+
+	return nil
+}
+
+func (s *memoryStore) Download(ctx context.Context, fileCollection string, file rocketchat.File) (string, error) {
+	data, ok := s.object(file.ID)
+	if !ok {
+		return "", store.ErrNotFound
+	}
+
+	filePath := filepath.Join(s.tempDir, file.ID)
+
+	return filePath, os.WriteFile(filePath, data, 0600)
+}
+
+func (s *memoryStore) Stat(ctx context.Context, fileCollection string, file rocketchat.File) (int64, error) {
+	data, ok := s.object(file.ID)
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+
+	return int64(len(data)), nil
+}
+
+func (s *memoryStore) List(ctx context.Context, fileCollection string, prefix string, fn func(key string, size int64) error) error {
+	s.mu.Lock()
+	objects := make(map[string][]byte, len(s.objects))
+	for key, data := range s.objects {
+		objects[key] = data
+	}
+	s.mu.Unlock()
+
+	for key, data := range objects {
+		if err := fn(key, int64(len(data))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, fileCollection string, file rocketchat.File, permanentelyDelete bool) error {
+	if !permanentelyDelete {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, file.ID)
+	s.deleted = append(s.deleted, file.ID)
+
+	return nil
+}
+
+func (s *memoryStore) Open(ctx context.Context, fileCollection string, file rocketchat.File) (io.ReadCloser, int64, error) {
+	data, ok := s.object(file.ID)
+	if !ok {
+		return nil, 0, store.ErrNotFound
+	}
+
+	size := int64(len(data))
+	if s.reportedSize != 0 {
+		size = s.reportedSize
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), size, nil
+}
+
+func (s *memoryStore) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	var data []byte
+
+	if s.exactReads && size >= 0 {
+		data = make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if data, err = io.ReadAll(r); err != nil {
+			return err
+		}
+
+		if size >= 0 && int64(len(data)) != size {
+			return fmt.Errorf("%w: copied %d bytes, expected %d", store.ErrSizeMismatch, len(data), size)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[objectPath] = data
+
+	return nil
+}
+
+// stagedStore hides the streaming methods of a memoryStore so files go through the temp file location
+type stagedStore struct {
+	store.Provider
+}
+
+func TestTransferFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		contents     string
+		size         int
+		reportedSize int64
+		exactReads   bool
+		staged       bool
+		wantErr      bool
+	}{
+		{name: "streams the file", contents: "hello", size: 5},
+		{name: "stages the file", contents: "hello", size: 5, staged: true},
+		{name: "ignores the size reported by the source", contents: "hello", size: 5, reportedSize: 3},
+		{name: "source shorter than the database", contents: "hel", size: 5, wantErr: true},
+		{name: "source longer than the database", contents: "hello world", size: 5, wantErr: true},
+		{name: "source shorter than the database with exact reads", contents: "hel", size: 5, exactReads: true, wantErr: true},
+		{name: "source longer than the database with exact reads", contents: "hello world", size: 5, exactReads: true, wantErr: true},
+		{name: "source longer than it reports", contents: "hello world", size: 5, reportedSize: 5, exactReads: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newMemoryStore("AmazonS3", map[string][]byte{"file1": []byte(tt.contents)})
+			source.SetTempDirectory(t.TempDir())
+			source.reportedSize = tt.reportedSize
+
+			destination := newMemoryStore("GoogleCloudStorage", nil)
+			destination.exactReads = tt.exactReads
+
+			m := &Migrate{
+				storeName: "Uploads",
+				log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			if tt.staged {
+				m.sourceStore = stagedStore{source}
+				m.destinationStore = stagedStore{destination}
+			} else {
+				m.sourceStore = source
+				m.destinationStore = destination
+			}
+
+			file := rocketchat.File{ID: "file1", Size: tt.size, Type: "text/plain"}
+			event := &fileEvent{File: file}
+
+			transferred, err := m.transferFile(context.Background(), event, file, "uploads/file1")
+
+			if tt.wantErr {
+				if !errors.Is(err, store.ErrSizeMismatch) {
+					t.Fatalf("transferFile() = %v, want ErrSizeMismatch", err)
+				}
+
+				var srcErr *sourceError
+				if !errors.As(err, &srcErr) {
+					t.Errorf("transferFile() = %v, want a source error", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("transferFile() = %v", err)
+			}
+
+			if transferred != int64(tt.size) {
+				t.Errorf("transferFile() transferred %d bytes, want %d", transferred, tt.size)
+			}
+
+			if data, _ := destination.object("uploads/file1"); string(data) != tt.contents {
+				t.Errorf("destination holds %q, want %q", data, tt.contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/RocketChat/filestore-migrator/rocketchat"
+	"github.com/RocketChat/filestore-migrator/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Problems reported by Verify
+const (
+	VerifyMissing  = "missing"
+	VerifySize     = "size"
+	VerifyChecksum = "checksum"
+	VerifyError    = "error"
+)
+
+// VerifyReport is the result of checking the files referenced by the database against the store
+type VerifyReport struct {
+	Store       string `json:"store"`
+	Destination string `json:"destination"`
+
+	Checked int `json:"checked"`
+	OK      int `json:"ok"`
+	// ChecksumSkipped counts the files whose checksum couldn't be compared because no run backed up
+	// their source location, or their source copy was deleted since
+	ChecksumSkipped int `json:"checksumSkipped"`
+
+	Mismatches []VerifyMismatch `json:"mismatches"`
+}
+
+// VerifyMismatch describes a file that failed verification
+type VerifyMismatch struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Problem           string `json:"problem"`
+	ExpectedSize      int64  `json:"expectedSize"`
+	ActualSize        int64  `json:"actualSize,omitempty"`
+	SourceSHA256      string `json:"sourceSha256,omitempty"`
+	DestinationSHA256 string `json:"destinationSha256,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// Verify checks that every file of the store referencing the destination has its object there
+// with the size recorded in the database. When a source store is provided, the source copy is
+// located through the backup saved by the run that migrated the file and the SHA-256 of both
+// copies is compared as well
+func (m *Migrate) Verify(ctx context.Context) (*VerifyReport, error) {
+	if m.destinationStore == nil {
+		return nil, fmt.Errorf("%w: For Verify must have a destination store provided", ErrInvalidConfig)
+	}
+
+	files, err := m.getFilesInStore(ctx, m.destinationStore, true)
+	if err != nil {
+		return nil, err
+	}
+
+	m.debugLog(fmt.Sprintf("Found %v files\n", files.total()))
+
+	report := &VerifyReport{
+		Store:       m.storeName,
+		Destination: m.destinationStore.StoreType(),
+		Mismatches:  []VerifyMismatch{},
+	}
+
+	if m.sourceStore != nil {
+		// Keep the destination copies apart from the source ones as both are named after the file id
+		verifyLocation := m.tempFileLocation + "/verify/" + strings.ToLower(m.storeName)
+		if err := os.MkdirAll(verifyLocation, 0777); err != nil {
+			return nil, err
+		}
+
+		m.destinationStore.SetTempDirectory(verifyLocation)
+		defer m.destinationStore.SetTempDirectory(m.tempFileLocation + "/" + strings.ToLower(m.storeName))
+	}
+
+	var mu sync.Mutex
+
+	err = m.processFiles(ctx, files, func(index int, file rocketchat.File) error {
+		m.debugLog(fmt.Sprintf("[%v/%v] Verifying %s on: %s\n", index, files.total(), file.Name, m.destinationStore.StoreType()))
+
+		mismatch, checksummed := m.verifyFile(ctx, file)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		report.Checked++
+
+		if !checksummed {
+			report.ChecksumSkipped++
+		}
+
+		if mismatch != nil {
+			m.debugLog(fmt.Sprintf("[%v/%v] Verification failed for %s: %s\n", index, files.total(), file.Name, mismatch.Problem))
+			report.Mismatches = append(report.Mismatches, *mismatch)
+
+			return nil
+		}
+
+		report.OK++
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// verifyFile checks a single file returning the mismatch found, if any, and whether the checksum was compared
+func (m *Migrate) verifyFile(ctx context.Context, file rocketchat.File) (*VerifyMismatch, bool) {
+	mismatch := &VerifyMismatch{
+		ID:           file.ID,
+		Name:         file.Name,
+		ExpectedSize: int64(file.Size),
+	}
+
+	size, err := m.destinationStore.Stat(ctx, m.fileCollectionName, file)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			mismatch.Problem = VerifyMissing
+		} else {
+			mismatch.Problem = VerifyError
+			mismatch.Error = err.Error()
+		}
+
+		return mismatch, false
+	}
+
+	mismatch.ActualSize = size
+
+	if size != int64(file.Size) {
+		mismatch.Problem = VerifySize
+		return mismatch, false
+	}
+
+	if m.sourceStore == nil {
+		return nil, false
+	}
+
+	// the document was repointed at the destination, the source copy is where the backup says
+	backup, err := m.sourceBackup(ctx, file.ID)
+	if err != nil {
+		mismatch.Problem = VerifyError
+		mismatch.Error = fmt.Sprintf("looking up the source of the file: %s", err)
+
+		return mismatch, false
+	}
+
+	if backup == nil || backup.SourceDeletedAt != nil {
+		return nil, false
+	}
+
+	sourceSum, err := m.hashObject(ctx, m.sourceStore, backup.sourceFile(file), false)
+	if err != nil {
+		mismatch.Problem = VerifyError
+		mismatch.Error = fmt.Sprintf("reading the source copy: %s", err)
+
+		return mismatch, false
+	}
+
+	destinationSum, err := m.hashObject(ctx, m.destinationStore, file, true)
+	if err != nil {
+		mismatch.Problem = VerifyError
+		mismatch.Error = err.Error()
+
+		return mismatch, false
+	}
+
+	if sourceSum != destinationSum {
+		mismatch.Problem = VerifyChecksum
+		mismatch.SourceSHA256 = sourceSum
+		mismatch.DestinationSHA256 = destinationSum
+
+		return mismatch, true
+	}
+
+	return nil, true
+}
+
+// sourceBackup returns the latest backup of the file saved when it was migrated from the source store,
+// or nil when no run backed it up
+func (m *Migrate) sourceBackup(ctx context.Context, fileID string) (*fileBackup, error) {
+	backupCollection, err := m.backupCollectionName()
+	if err != nil {
+		return nil, err
+	}
+
+	query := bson.M{
+		"fileId":     fileID,
+		"store":      m.sourceStore.StoreType() + ":" + m.storeName,
+		"restoredAt": bson.M{"$exists": false},
+	}
+
+	var backup fileBackup
+
+	err = m.session.Client().Database(m.databaseName).Collection(backupCollection).
+		FindOne(ctx, query, options.FindOne().SetSort(bson.M{"createdAt": -1})).Decode(&backup)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+	}
+
+	return &backup, nil
+}
+
+// hashObject returns the hex encoded SHA-256 of the file stored in the provider. The file is streamed when
+// the provider supports it, otherwise it is downloaded to the temp file location and removed afterwards if cleanup is set
+func (m *Migrate) hashObject(ctx context.Context, provider store.Provider, file rocketchat.File, cleanup bool) (string, error) {
+	var reader io.ReadCloser
+
+	if streamer, ok := provider.(store.StreamProvider); ok {
+		r, _, err := streamer.Open(ctx, m.fileCollectionName, file)
+		if err != nil {
+			return "", err
+		}
+
+		reader = r
+	} else {
+		path, err := provider.Download(ctx, m.fileCollectionName, file)
+		if err != nil {
+			return "", err
+		}
+
+		if cleanup {
+			defer os.Remove(path)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+
+		reader = f
+	}
+
+	defer reader.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Summary returns a short human readable description of the report
+func (r *VerifyReport) Summary() string {
+	return fmt.Sprintf("%s: %d files checked on %s, %d ok, %d mismatches, %d without checksum comparison",
+		r.Store, r.Checked, r.Destination, r.OK, len(r.Mismatches), r.ChecksumSkipped)
+}
+
+// WriteJSON writes the report as indented JSON to the given path
+func (r *VerifyReport) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}